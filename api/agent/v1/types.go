@@ -0,0 +1,275 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1 contains the wire types exchanged between the IPA controller and
+// an IPA agent's /askllm endpoint.
+package v1
+
+// Version is the apiVersion of the request document described by this package.
+const Version = "agent.ipa.shafinhasnat.me/v1"
+
+// Request is the document the controller posts to /askllm for a single target.
+type Request struct {
+	// APIVersion is always Version for documents produced by this package.
+	APIVersion string `json:"apiVersion"`
+	Target     Target `json:"target"`
+	// Spec is the current replica count and container resources of the target.
+	Spec    WorkloadSpec `json:"spec"`
+	Metrics []Metric     `json:"metrics"`
+	Events  []Event      `json:"events,omitempty"`
+	// Ingress holds traffic signals for the ingress in front of the target, if any.
+	Ingress *Ingress `json:"ingress,omitempty"`
+	// Features is a statistical digest of the metrics, ingress traffic and
+	// container states. The raw series are only included when requested.
+	Features *Features `json:"features,omitempty"`
+}
+
+// NewRequest returns an empty Request for the given target.
+func NewRequest(target Target) *Request {
+	return &Request{APIVersion: Version, Target: target}
+}
+
+// Target identifies the workload being scaled.
+type Target struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// WorkloadSpec is the current scaling state of the target.
+type WorkloadSpec struct {
+	Replicas      int32           `json:"replicas"`
+	ReadyReplicas int32           `json:"readyReplicas"`
+	Containers    []ContainerSpec `json:"containers"`
+}
+
+// ContainerSpec holds the CPU and memory settings of a container. Unset
+// values are empty strings.
+type ContainerSpec struct {
+	Name          string `json:"name"`
+	CPURequest    string `json:"cpuRequest,omitempty"`
+	CPULimit      string `json:"cpuLimit,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	MemoryLimit   string `json:"memoryLimit,omitempty"`
+}
+
+// Metric is the result of a single query. Per-container signals such as
+// cpu_usage carry a container label on each series.
+type Metric struct {
+	// Name is a stable identifier for the signal, e.g. cpu_usage.
+	Name string `json:"name"`
+	// Query is the query that produced the series.
+	Query string `json:"query,omitempty"`
+	// Custom is true for queries configured on the IPA group rather than built in.
+	Custom bool `json:"custom,omitempty"`
+	// Window is the time range and resolution the query was run over, when
+	// the source keeps history.
+	Window *Window `json:"window,omitempty"`
+	// Context is true for the coarser, summarized views of a query that give
+	// the agent longer term context. Their series carry a summary.
+	Context bool `json:"context,omitempty"`
+	// Series is omitted when only features are sent.
+	Series []Series `json:"series,omitempty"`
+}
+
+// Window is the time range of a query in Prometheus duration notation, e.g.
+// a range of 1h with an offset of 7d covers the same hour one week ago.
+type Window struct {
+	Range  string `json:"range"`
+	Step   string `json:"step"`
+	Offset string `json:"offset,omitempty"`
+}
+
+// Series is a labelled list of samples.
+type Series struct {
+	Labels  map[string]string `json:"labels,omitempty"`
+	Samples []Sample          `json:"samples"`
+	// Summary condenses all samples of the series, which may have been
+	// averaged down to fewer samples.
+	Summary *Summary `json:"summary,omitempty"`
+}
+
+// Summary holds statistics over the samples of a series.
+type Summary struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+	Last  float64 `json:"last"`
+	Count int     `json:"count"`
+}
+
+// Sample is a single value at a Unix timestamp in seconds.
+type Sample struct {
+	Timestamp float64 `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// Event is a Kubernetes event recorded against one of the target's pods.
+type Event struct {
+	Pod     string `json:"pod"`
+	Type    string `json:"type"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	Count   int32  `json:"count,omitempty"`
+}
+
+// Ingress holds traffic signals for an ingress.
+// The series are omitted when only features are sent.
+type Ingress struct {
+	Name string `json:"name"`
+	// Controller is the ingress controller the signals were read from, e.g. Nginx.
+	Controller  string   `json:"controller,omitempty"`
+	RequestRate []Series `json:"requestRate,omitempty"`
+	// ErrorRatio is the fraction of requests answered with a 5xx status.
+	ErrorRatio []Series `json:"errorRatio,omitempty"`
+	// Duration holds request duration quantiles in seconds, when the
+	// controller exports a duration histogram.
+	Duration *RequestDuration `json:"duration,omitempty"`
+}
+
+// RequestDuration holds request duration quantiles in seconds.
+type RequestDuration struct {
+	P50 []Series `json:"p50,omitempty"`
+	P95 []Series `json:"p95,omitempty"`
+	P99 []Series `json:"p99,omitempty"`
+}
+
+// Features condenses the signals of a request into a few numbers per metric
+// and container.
+type Features struct {
+	Metrics    []MetricFeatures    `json:"metrics,omitempty"`
+	Containers []ContainerFeatures `json:"containers,omitempty"`
+}
+
+// MetricFeatures are the statistics of a metric. Series of the same container
+// are pooled across pods; other series are described one by one.
+type MetricFeatures struct {
+	Name    string            `json:"name"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Custom  bool              `json:"custom,omitempty"`
+	Context bool              `json:"context,omitempty"`
+	Window  *Window           `json:"window,omitempty"`
+	// Series is the number of series pooled into the statistics.
+	Series int `json:"series"`
+	Stats
+}
+
+// Stats describe a set of samples.
+type Stats struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+	P95 float64 `json:"p95"`
+	// Last is the average of the last sample of each series.
+	Last float64 `json:"last"`
+	// Slope is the least squares change of the value per minute.
+	Slope float64 `json:"slope"`
+	// Trend is TrendRising or TrendFalling when the slope changes the value by
+	// more than a tenth of its average over the window, and TrendFlat otherwise.
+	Trend   string `json:"trend"`
+	Samples int    `json:"samples"`
+}
+
+// Trends of a metric.
+const (
+	TrendRising  = "rising"
+	TrendFalling = "falling"
+	TrendFlat    = "flat"
+)
+
+// ContainerFeatures describe the usage and health of a container across the
+// target's pods.
+type ContainerFeatures struct {
+	Name string `json:"name"`
+	// CPU is in cores and Memory in bytes.
+	CPU    *Utilization `json:"cpu,omitempty"`
+	Memory *Utilization `json:"memory,omitempty"`
+	// Restarts is the sum of the container's restart counts over all pods.
+	Restarts int32 `json:"restarts"`
+	// Saturation lists the Saturation* flags that apply to the container.
+	Saturation []string `json:"saturation,omitempty"`
+}
+
+// Utilization is the usage of a resource relative to the container's current
+// request and limit. The ratios are omitted when no request or limit is set.
+type Utilization struct {
+	Avg          float64 `json:"avg"`
+	P95          float64 `json:"p95"`
+	Max          float64 `json:"max"`
+	P95OfRequest float64 `json:"p95OfRequest,omitempty"`
+	MaxOfLimit   float64 `json:"maxOfLimit,omitempty"`
+}
+
+// Saturation flags of a container.
+const (
+	// SaturationCPURequest and SaturationMemoryRequest mean the p95 usage
+	// is above the request.
+	SaturationCPURequest    = "cpu_over_request"
+	SaturationMemoryRequest = "memory_over_request"
+	// SaturationCPULimit and SaturationMemoryLimit mean the peak usage reached
+	// 90% of the limit, where CPU is throttled and memory risks an OOM kill.
+	SaturationCPULimit    = "cpu_near_limit"
+	SaturationMemoryLimit = "memory_near_limit"
+	// SaturationOOMKilled means the container was last terminated for running
+	// out of memory in at least one pod.
+	SaturationOOMKilled = "oom_killed"
+)
+
+// Response is the document returned by /askllm.
+type Response struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Config  Config `json:"text"`
+}
+
+// Config is the recommendation returned by the agent. The top-level resource
+// fields apply to every container that has no entry in Containers.
+type Config struct {
+	Replicas      int32  `json:"replicas"`
+	CPULimit      string `json:"cpu_limit,omitempty"`
+	CPURequest    string `json:"cpu_request,omitempty"`
+	MemoryLimit   string `json:"memory_limit,omitempty"`
+	MemoryRequest string `json:"memory_request,omitempty"`
+	// Containers holds per-container recommendations keyed by container name.
+	Containers map[string]ContainerConfig `json:"containers,omitempty"`
+}
+
+// ContainerConfig is the resource recommendation for a single container.
+type ContainerConfig struct {
+	CPULimit      string `json:"cpu_limit"`
+	CPURequest    string `json:"cpu_request"`
+	MemoryLimit   string `json:"memory_limit"`
+	MemoryRequest string `json:"memory_request"`
+}
+
+// ForContainer returns the recommendation for the named container, falling
+// back to the top-level fields.
+func (c Config) ForContainer(name string) ContainerConfig {
+	if container, ok := c.Containers[name]; ok {
+		return container
+	}
+	return ContainerConfig{
+		CPULimit:      c.CPULimit,
+		CPURequest:    c.CPURequest,
+		MemoryLimit:   c.MemoryLimit,
+		MemoryRequest: c.MemoryRequest,
+	}
+}
+
+// IsEmpty reports whether no resource value is set.
+func (c ContainerConfig) IsEmpty() bool {
+	return c == ContainerConfig{}
+}
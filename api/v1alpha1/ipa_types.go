@@ -17,6 +17,9 @@ limitations under the License.
 package v1alpha1
 
 import (
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -30,18 +33,371 @@ type IPASpec struct {
 
 	// Foo is an example field of IPA. Edit ipa_types.go to remove/update
 	Metadata Metadata `json:"metadata"`
+	// Mode controls whether recommendations are applied to the target
+	// deployments or only recorded in status.
+	// +kubebuilder:default=Apply
+	// +optional
+	Mode Mode `json:"mode,omitempty"`
+	// Interval is how often the IPA is evaluated. Defaults to 1m.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Parallelism is the maximum number of groups evaluated at the same time.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=4
+	// +optional
+	Parallelism *int32 `json:"parallelism,omitempty"`
+	// GroupTimeout bounds the time spent evaluating a single group, including
+	// metric queries and the LLM call. Defaults to 2m.
+	// +optional
+	GroupTimeout *metav1.Duration `json:"groupTimeout,omitempty"`
+	// RemovalPolicy controls what happens to a workload when its group is
+	// removed or the IPA is deleted. Restore puts back the replicas and
+	// container resources it had before IPA first changed it.
+	// +kubebuilder:default=Retain
+	// +optional
+	RemovalPolicy RemovalPolicy `json:"removalPolicy,omitempty"`
 }
 
+// RemovalPolicy selects what happens to a workload IPA stops managing.
+// +kubebuilder:validation:Enum=Retain;Restore
+type RemovalPolicy string
+
+const (
+	// RemovalPolicyRetain leaves the workload with the values IPA last applied.
+	RemovalPolicyRetain RemovalPolicy = "Retain"
+	// RemovalPolicyRestore restores the values the workload had before IPA first changed it.
+	RemovalPolicyRestore RemovalPolicy = "Restore"
+)
+
+// Mode selects what the controller does with a recommendation.
+// +kubebuilder:validation:Enum=Recommend;Apply
+type Mode string
+
+const (
+	// ModeRecommend records recommendations in status without touching the deployment.
+	ModeRecommend Mode = "Recommend"
+	// ModeApply applies recommendations to the deployment.
+	ModeApply Mode = "Apply"
+)
+
+// +kubebuilder:validation:XValidation:rule="(has(self.metricsSource) && self.metricsSource != 'Prometheus') || has(self.prometheusUri)",message="prometheusUri is required for the Prometheus metrics source"
+// +kubebuilder:validation:XValidation:rule="!has(self.metricsSource) || self.metricsSource != 'StaticFile' || has(self.metricsFile)",message="metricsFile is required for the StaticFile metrics source"
 type Metadata struct {
-	PrometheusUri string     `json:"prometheusUri"`
-	LLMAgent      string     `json:"llmAgent"`
-	IPAGroup      []IPAGroup `json:"ipaGroup"`
+	// MetricsSource selects where metrics are read from.
+	// +kubebuilder:default=Prometheus
+	// +optional
+	MetricsSource MetricsSourceType `json:"metricsSource,omitempty"`
+	// PrometheusUri is the base URL of a Prometheus compatible query API,
+	// including any path prefix, e.g. http://thanos-query:9090 or
+	// http://vmselect:8481/select/0/prometheus. Required for the Prometheus source.
+	// +optional
+	PrometheusUri string `json:"prometheusUri,omitempty"`
+	// MetricsFile is the path of a JSON file holding the metrics returned by
+	// the StaticFile source. It must lie in the directory the controller was
+	// started with in --metrics-file-dir, and relative paths are taken from it.
+	// +optional
+	MetricsFile string `json:"metricsFile,omitempty"`
+	// PrometheusAuth holds the credentials and TLS settings used to query PrometheusUri.
+	// +optional
+	PrometheusAuth *EndpointAuth `json:"prometheusAuth,omitempty"`
+	// LLMAgent is the base URL of the LLM provider endpoint.
+	LLMAgent string `json:"llmAgent"`
+	// LLMAgentAuth holds the credentials and TLS settings used to call LLMAgent.
+	// They are the only credentials sent to it; the controller never sends
+	// API keys from its own environment. For Anthropic, set the x-api-key
+	// header from a Secret.
+	// +optional
+	LLMAgentAuth *EndpointAuth `json:"llmAgentAuth,omitempty"`
+	// LLMProvider selects the protocol used to talk to LLMAgent.
+	// +kubebuilder:default=IPAAgent
+	// +optional
+	LLMProvider LLMProvider `json:"llmProvider,omitempty"`
+	// LLMModel is the model name sent to OpenAI and Anthropic providers.
+	// +optional
+	LLMModel string `json:"llmModel,omitempty"`
+	// IPAGroup lists the workloads to scale. The controller server-side
+	// applies spec.replicas and the container resources it manages with the
+	// field manager "ipa-controller" and forcibly takes ownership of those
+	// fields, overriding any other manager that set them. GitOps tools such
+	// as Argo CD and Flux will report IPA as their owner; configure them to
+	// ignore fields managed by ipa-controller, e.g. Argo CD ignoreDifferences
+	// with managedFieldsManagers, to avoid reverting them.
+	IPAGroup []IPAGroup `json:"ipaGroup"`
+}
+
+// EndpointAuth configures how the controller authenticates to an HTTP
+// endpoint. Every Secret is read from the namespace of the IPA and watched,
+// so rotated credentials are used from the next evaluation on.
+// +kubebuilder:validation:XValidation:rule="!(has(self.bearerToken) && has(self.basicAuth))",message="at most one of bearerToken and basicAuth may be set"
+type EndpointAuth struct {
+	// BearerToken is sent in the Authorization header as a bearer token.
+	// +optional
+	BearerToken *corev1.SecretKeySelector `json:"bearerToken,omitempty"`
+	// BasicAuth is sent in the Authorization header as HTTP basic auth.
+	// +optional
+	BasicAuth *BasicAuth `json:"basicAuth,omitempty"`
+	// Headers are added to every request, e.g. an API key header required by a gateway.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Headers []SecretHeader `json:"headers,omitempty"`
+	// TLS configures the CA bundle and client certificate used for the connection.
+	// +optional
+	TLS *TLSConfig `json:"tls,omitempty"`
 }
 
+// BasicAuth holds references to a username and password.
+type BasicAuth struct {
+	Username corev1.SecretKeySelector `json:"username"`
+	Password corev1.SecretKeySelector `json:"password"`
+}
+
+// SecretHeader is a request header whose value is read from a Secret.
+type SecretHeader struct {
+	Name      string                   `json:"name"`
+	ValueFrom corev1.SecretKeySelector `json:"valueFrom"`
+}
+
+// TLSConfig references PEM encoded certificates for verifying the server and,
+// for mutual TLS, authenticating the controller.
+// +kubebuilder:validation:XValidation:rule="has(self.cert) == has(self.key)",message="cert and key must be set together"
+type TLSConfig struct {
+	// CA is a bundle of certificates trusted in addition to the system roots.
+	// +optional
+	CA *corev1.SecretKeySelector `json:"ca,omitempty"`
+	// Cert is the client certificate presented to the server.
+	// +optional
+	Cert *corev1.SecretKeySelector `json:"cert,omitempty"`
+	// Key is the private key of Cert.
+	// +optional
+	Key *corev1.SecretKeySelector `json:"key,omitempty"`
+}
+
+// MetricsSourceType selects where the controller reads metrics from.
+// MetricsServer only provides current CPU and memory usage, and StaticFile
+// returns the same metrics for every workload, for tests and demos.
+// +kubebuilder:validation:Enum=Prometheus;MetricsServer;StaticFile
+type MetricsSourceType string
+
+const (
+	// MetricsSourcePrometheus queries the Prometheus HTTP API at PrometheusUri.
+	MetricsSourcePrometheus MetricsSourceType = "Prometheus"
+	// MetricsSourceMetricsServer reads pod usage from the metrics.k8s.io API.
+	MetricsSourceMetricsServer MetricsSourceType = "MetricsServer"
+	// MetricsSourceStaticFile reads metrics from MetricsFile.
+	MetricsSourceStaticFile MetricsSourceType = "StaticFile"
+)
+
+// LLMProvider is the protocol used to request recommendations.
+// IPAAgent posts metrics to the /askllm endpoint of an IPA agent, OpenAI uses
+// an OpenAI-compatible chat completions API and Anthropic uses the Messages API.
+// +kubebuilder:validation:Enum=IPAAgent;OpenAI;Anthropic
+type LLMProvider string
+
+// ControlledValues is the set of container resource values the controller manages.
+// ProportionalLimits manages requests and scales limits to keep each
+// container's current limit-to-request ratio.
+// +kubebuilder:validation:Enum=RequestsAndLimits;RequestsOnly;LimitsOnly;ProportionalLimits
+type ControlledValues string
+
+const (
+	// ControlledRequestsAndLimits sets both requests and limits from the recommendation.
+	ControlledRequestsAndLimits ControlledValues = "RequestsAndLimits"
+	// ControlledRequestsOnly sets requests and leaves limits unchanged.
+	ControlledRequestsOnly ControlledValues = "RequestsOnly"
+	// ControlledLimitsOnly sets limits and leaves requests unchanged.
+	ControlledLimitsOnly ControlledValues = "LimitsOnly"
+	// ControlledProportionalLimits sets requests and scales limits by the current ratio.
+	ControlledProportionalLimits ControlledValues = "ProportionalLimits"
+)
+
+// +kubebuilder:validation:XValidation:rule="[has(self.deployment), has(self.scaleTargetRef), has(self.targetSelector)].filter(x, x).size() == 1",message="exactly one of deployment, scaleTargetRef and targetSelector must be set"
+// +kubebuilder:validation:XValidation:rule="has(self.__namespace__) || (has(self.targetSelector) && has(self.targetSelector.namespaceSelector))",message="namespace is required unless targetSelector.namespaceSelector is set"
 type IPAGroup struct {
-	Deployment string `json:"deployment"`
-	Namespace  string `json:"namespace"`
-	Ingress    string `json:"ingress,omitempty"`
+	// Deployment is the name of a Deployment to scale.
+	// Deprecated: use ScaleTargetRef.
+	// +optional
+	Deployment string `json:"deployment,omitempty"`
+	// ScaleTargetRef points to the workload to scale. Replicas are changed
+	// through its /scale subresource and container resources through its pod
+	// template, when the kind has one at spec.template.
+	// +optional
+	ScaleTargetRef *autoscalingv2.CrossVersionObjectReference `json:"scaleTargetRef,omitempty"`
+	// TargetSelector expands the group to every workload matching its
+	// selectors at reconcile time. The other settings of the group apply to
+	// each discovered workload.
+	// +optional
+	TargetSelector *TargetSelector `json:"targetSelector,omitempty"`
+	// Namespace is the namespace of the workload, or the namespace searched by
+	// TargetSelector when it has no namespace selector.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Ingress names the entry point whose traffic is sent to the LLM agent:
+	// the Ingress for Nginx and Traefik, the backend Service for HAProxy and
+	// Contour, and the HTTPRoute for GatewayAPI. No traffic is queried when empty.
+	// +optional
+	Ingress string `json:"ingress,omitempty"`
+	// IngressController selects the metrics the ingress traffic is read from.
+	// +kubebuilder:default=Nginx
+	// +optional
+	IngressController IngressControllerType `json:"ingressController,omitempty"`
+	// Queries adds custom PromQL queries to the metrics sent to the LLM agent,
+	// e.g. consumer lag or queue depth.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Queries []MetricQuery `json:"queries,omitempty"`
+	// DisabledQueries lists built-in queries that are not run for the group.
+	// +listType=set
+	// +optional
+	DisabledQueries []BuiltinQuery `json:"disabledQueries,omitempty"`
+	// Window sets the time range and resolution of the group's metric queries.
+	// +optional
+	Window *MetricsWindow `json:"window,omitempty"`
+	// RawMetrics sends the raw metric series to the LLM agent next to their
+	// extracted features. By default only the features are sent, which keeps
+	// the prompt small with many replicas.
+	// +optional
+	RawMetrics bool `json:"rawMetrics,omitempty"`
+	// ExcludeContainers lists containers whose resources the controller must not change.
+	// +optional
+	ExcludeContainers []string `json:"excludeContainers,omitempty"`
+	// ControlledValues selects which container resource values the controller
+	// manages. Resource keys other than cpu and memory are never changed.
+	// +kubebuilder:default=RequestsAndLimits
+	// +optional
+	ControlledValues ControlledValues `json:"controlledValues,omitempty"`
+	// MinReplicas is the lowest replica count the controller will apply.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// MaxReplicas is the highest replica count the controller will apply.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+	// Resources bounds the CPU and memory values recommended by the LLM agent.
+	// +optional
+	Resources *ResourceBounds `json:"resources,omitempty"`
+	// StepLimits rejects recommendations that move too far from the current
+	// values in a single step.
+	// +optional
+	StepLimits *StepLimits `json:"stepLimits,omitempty"`
+	// Behavior damps replica changes over time to prevent flapping.
+	// +optional
+	Behavior *ScalingBehavior `json:"behavior,omitempty"`
+}
+
+// MetricQuery is a named PromQL query template. The template can use
+// {{.Namespace}}, {{.Deployment}}, the name of the workload whatever its kind,
+// {{.Kind}}, {{.PodRegex}}, a regular expression matching the workload's pods,
+// {{.Ingress}} and {{.RateWindow}}, the range to use with rate().
+type MetricQuery struct {
+	// Name identifies the results in the metrics sent to the LLM agent.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z_][a-zA-Z0-9_]*$`
+	Name string `json:"name"`
+	// Query is the PromQL template, e.g.
+	// sum(kafka_consumergroup_lag{namespace="{{.Namespace}}", consumergroup="{{.Deployment}}"}).
+	Query string `json:"query"`
+}
+
+// MetricsWindow configures the time range and resolution of metric queries.
+// Only the Prometheus metrics source keeps history.
+type MetricsWindow struct {
+	// Range is how far back the series reach. Defaults to 5m.
+	// +optional
+	Range *metav1.Duration `json:"range,omitempty"`
+	// Step is the time between two samples. Defaults to 1m.
+	// +optional
+	Step *metav1.Duration `json:"step,omitempty"`
+	// RateWindow is the range of rate() in the built-in queries and of
+	// {{.RateWindow}} in custom queries. Defaults to 2m.
+	// +optional
+	RateWindow *metav1.Duration `json:"rateWindow,omitempty"`
+	// MultiResolution adds summarized context to every query: the last 15m
+	// at 30s, the last 24h at 15m and the same hour one week ago at 5m.
+	// Each series carries its min, max, mean and last value and at most 32
+	// samples, averaged down where needed.
+	// +optional
+	MultiResolution bool `json:"multiResolution,omitempty"`
+}
+
+// BuiltinQuery names a query the controller runs for every group.
+// ingress_duration covers the p50, p95 and p99 request durations.
+// +kubebuilder:validation:Enum=replicas;cpu_usage;memory_usage;node_available_memory;ingress_requests;ingress_error_ratio;ingress_duration
+type BuiltinQuery string
+
+// IngressControllerType selects the metrics of an ingress controller.
+// +kubebuilder:validation:Enum=Nginx;Traefik;HAProxy;Contour;GatewayAPI
+type IngressControllerType string
+
+const (
+	// IngressControllerNginx reads the ingress-nginx request metrics.
+	IngressControllerNginx IngressControllerType = "Nginx"
+	// IngressControllerTraefik reads Traefik router metrics, which need
+	// addRoutersLabels enabled.
+	IngressControllerTraefik IngressControllerType = "Traefik"
+	// IngressControllerHAProxy reads HAProxy backend metrics. HAProxy
+	// exports no duration histogram, so no durations are sent.
+	IngressControllerHAProxy IngressControllerType = "HAProxy"
+	// IngressControllerContour reads the Envoy cluster metrics of Contour.
+	IngressControllerContour IngressControllerType = "Contour"
+	// IngressControllerGatewayAPI reads the Envoy cluster metrics of an
+	// Envoy Gateway HTTPRoute.
+	IngressControllerGatewayAPI IngressControllerType = "GatewayAPI"
+)
+
+// ScalingBehavior configures cooldowns and stabilization for replica changes.
+type ScalingBehavior struct {
+	// ScaleUpCooldown is the minimum time between two scale ups.
+	// +optional
+	ScaleUpCooldown *metav1.Duration `json:"scaleUpCooldown,omitempty"`
+	// ScaleDownCooldown is the minimum time between any replica change and a
+	// following scale down.
+	// +optional
+	ScaleDownCooldown *metav1.Duration `json:"scaleDownCooldown,omitempty"`
+	// StabilizationWindow is how far back recommendations are considered when
+	// scaling down. Like the HorizontalPodAutoscaler, the highest replica count
+	// recommended inside the window is used, so one low recommendation does
+	// not shrink the deployment.
+	// +optional
+	StabilizationWindow *metav1.Duration `json:"stabilizationWindow,omitempty"`
+}
+
+// StepLimits caps the change a single recommendation may make, as a percentage
+// of the current value. A recommendation that exceeds any limit is rejected.
+type StepLimits struct {
+	// MaxReplicaIncreasePercent is the largest replica increase allowed, e.g. 100 allows doubling.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxReplicaIncreasePercent *int32 `json:"maxReplicaIncreasePercent,omitempty"`
+	// MaxReplicaDecreasePercent is the largest replica decrease allowed, e.g. 50 allows halving.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	MaxReplicaDecreasePercent *int32 `json:"maxReplicaDecreasePercent,omitempty"`
+	// MaxResourceIncreasePercent is the largest increase allowed for any CPU or memory request or limit.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxResourceIncreasePercent *int32 `json:"maxResourceIncreasePercent,omitempty"`
+	// MaxResourceDecreasePercent is the largest decrease allowed for any CPU or memory request or limit.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	MaxResourceDecreasePercent *int32 `json:"maxResourceDecreasePercent,omitempty"`
+}
+
+// ResourceBounds holds floor and ceiling values for each managed resource field.
+type ResourceBounds struct {
+	CPURequest    *QuantityBounds `json:"cpuRequest,omitempty"`
+	CPULimit      *QuantityBounds `json:"cpuLimit,omitempty"`
+	MemoryRequest *QuantityBounds `json:"memoryRequest,omitempty"`
+	MemoryLimit   *QuantityBounds `json:"memoryLimit,omitempty"`
+}
+
+// QuantityBounds is an inclusive range for a resource quantity. Either end may be omitted.
+type QuantityBounds struct {
+	Min *resource.Quantity `json:"min,omitempty"`
+	Max *resource.Quantity `json:"max,omitempty"`
 }
 
 // IPAStatus defines the observed state of IPA.
@@ -49,10 +405,220 @@ type IPAStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Status string `json:"status,omitempty"`
+	// ObservedGeneration is the generation of the spec last reconciled.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the state of the last reconciliation.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Groups holds the observed state of each entry in ipaGroup.
+	// +optional
+	Groups []IPAGroupStatus `json:"groups,omitempty"`
+}
+
+// TargetSelector discovers the workloads of an IPA group by label.
+type TargetSelector struct {
+	// APIVersion of the workloads, apps/v1 by default.
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Kind of the workloads, Deployment by default.
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// NamespaceSelector selects the namespaces searched for workloads. When
+	// unset, only the group's namespace is searched.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Selector matches the labels of the workloads.
+	Selector metav1.LabelSelector `json:"selector"`
+}
+
+// IPAGroupStatus is the observed state of a single IPA group.
+type IPAGroupStatus struct {
+	// ScaleTargetRef is the workload the status entry belongs to.
+	ScaleTargetRef autoscalingv2.CrossVersionObjectReference `json:"scaleTargetRef"`
+	Namespace      string                                    `json:"namespace"`
+	// Discovered is true when the workload was found through a target selector.
+	// +optional
+	Discovered bool `json:"discovered,omitempty"`
+	// Metrics summarizes the workload state observed during the last reconciliation.
+	// +optional
+	Metrics *MetricsSummary `json:"metrics,omitempty"`
+	// Recommendation is the last recommendation produced for the group,
+	// after guardrails were applied.
+	// +optional
+	Recommendation *Recommendation `json:"recommendation,omitempty"`
+	// Clamps lists the recommended values that were pulled back into the
+	// configured bounds during the last reconciliation.
+	// +optional
+	Clamps []Clamp `json:"clamps,omitempty"`
+	// LastScaleUpTime is when the controller last increased the replica count.
+	// +optional
+	LastScaleUpTime *metav1.Time `json:"lastScaleUpTime,omitempty"`
+	// LastScaleDownTime is when the controller last decreased the replica count.
+	// +optional
+	LastScaleDownTime *metav1.Time `json:"lastScaleDownTime,omitempty"`
+	// RecentReplicas holds the replica recommendations inside the stabilization window.
+	// +optional
+	RecentReplicas []TimedReplicas `json:"recentReplicas,omitempty"`
+	// LastAppliedTime is when a recommendation was last applied to the deployment.
+	// +optional
+	LastAppliedTime *metav1.Time `json:"lastAppliedTime,omitempty"`
+	// Message is the error from the last reconciliation of the group, empty if it succeeded.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Failures is the number of consecutive reconciliations of the group that failed.
+	// +optional
+	Failures int32 `json:"failures,omitempty"`
+	// History holds the most recent decisions for the group, oldest first.
+	// +optional
+	History []Decision `json:"history,omitempty"`
+	// Original holds the replicas and container resources the workload had
+	// before IPA first changed it, for RemovalPolicy Restore.
+	// +optional
+	Original *WorkloadSnapshot `json:"original,omitempty"`
+}
+
+// WorkloadSnapshot is the replica count and container resources of a workload.
+type WorkloadSnapshot struct {
+	Replicas int32 `json:"replicas"`
+	// Containers holds the CPU and memory resources of each managed container.
+	// +optional
+	Containers []ContainerSnapshot `json:"containers,omitempty"`
+	Time       metav1.Time         `json:"time"`
+}
+
+// ContainerSnapshot is the CPU and memory resources of a single container.
+type ContainerSnapshot struct {
+	Name string `json:"name"`
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// TimedReplicas is a replica recommendation and when it was made.
+type TimedReplicas struct {
+	Replicas int32       `json:"replicas"`
+	Time     metav1.Time `json:"time"`
 }
 
+// MetricsSummary is a compact view of the workload at the time it was evaluated.
+type MetricsSummary struct {
+	Replicas      int32 `json:"replicas"`
+	ReadyReplicas int32 `json:"readyReplicas"`
+	Pods          int32 `json:"pods"`
+	Events        int32 `json:"events"`
+	// Containers is the CPU and memory usage of each container over the
+	// queried window, pooled across pods.
+	// +optional
+	Containers []ContainerUsage `json:"containers,omitempty"`
+	// Ingress is the traffic observed on the group's ingress, if it has one.
+	// +optional
+	Ingress *IngressSummary `json:"ingress,omitempty"`
+	Time    metav1.Time     `json:"time"`
+}
+
+// ContainerUsage is the observed resource usage of a container.
+type ContainerUsage struct {
+	Name string `json:"name"`
+	// +optional
+	CPUAvg *resource.Quantity `json:"cpuAvg,omitempty"`
+	// +optional
+	CPUP95 *resource.Quantity `json:"cpuP95,omitempty"`
+	// +optional
+	MemoryAvg *resource.Quantity `json:"memoryAvg,omitempty"`
+	// +optional
+	MemoryP95 *resource.Quantity `json:"memoryP95,omitempty"`
+}
+
+// IngressSummary is the average ingress traffic over the queried window.
+// Signals the ingress controller does not export are left empty.
+type IngressSummary struct {
+	// RequestRate is in requests per second.
+	// +optional
+	RequestRate string `json:"requestRate,omitempty"`
+	// ErrorRatio is the fraction of requests answered with a 5xx status.
+	// +optional
+	ErrorRatio string `json:"errorRatio,omitempty"`
+	// LatencyP95 is the p95 request duration.
+	// +optional
+	LatencyP95 *metav1.Duration `json:"latencyP95,omitempty"`
+}
+
+// Decision is a single recommendation and what the controller did with it.
+type Decision struct {
+	Recommendation `json:",inline"`
+	// Applied is true if the recommendation was written to the deployment.
+	Applied bool `json:"applied"`
+	// Message explains why the recommendation was not applied, if it wasn't.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// Recommendation is the replica count and container resources proposed for a group.
+// The top-level resource fields apply to containers without their own entry.
+type Recommendation struct {
+	Replicas      int32  `json:"replicas"`
+	CPURequest    string `json:"cpuRequest,omitempty"`
+	CPULimit      string `json:"cpuLimit,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	MemoryLimit   string `json:"memoryLimit,omitempty"`
+	// Containers holds per-container recommendations.
+	// +optional
+	Containers []ContainerRecommendation `json:"containers,omitempty"`
+	Time       metav1.Time               `json:"time"`
+}
+
+// ContainerRecommendation is the resources proposed for a single container.
+type ContainerRecommendation struct {
+	Name          string `json:"name"`
+	CPURequest    string `json:"cpuRequest,omitempty"`
+	CPULimit      string `json:"cpuLimit,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	MemoryLimit   string `json:"memoryLimit,omitempty"`
+}
+
+// Clamp records a recommendation that fell outside the configured bounds.
+type Clamp struct {
+	// Field is the recommendation field that was clamped, e.g. replicas or memoryLimit.
+	Field string `json:"field"`
+	// Container is the container the clamped value belongs to, empty for
+	// replicas and the top-level resource defaults.
+	// +optional
+	Container string `json:"container,omitempty"`
+	// Recommended is the value returned by the LLM agent.
+	Recommended string `json:"recommended"`
+	// Applied is the value after clamping.
+	Applied string      `json:"applied"`
+	Time    metav1.Time `json:"time"`
+}
+
+// Condition types reported in IPAStatus.
+const (
+	// ConditionReady is True when the last reconciliation finished without error.
+	ConditionReady = "Ready"
+	// ConditionMetricsAvailable is True when metrics could be collected for every group.
+	ConditionMetricsAvailable = "MetricsAvailable"
+	// ConditionAgentReachable is True when the LLM agent returned a recommendation.
+	ConditionAgentReachable = "AgentReachable"
+	// ConditionRecommendationValid is False when a recommendation failed validation and was not applied.
+	ConditionRecommendationValid = "RecommendationValid"
+	// ConditionApplied is True when recommendations were applied to the target deployments.
+	ConditionApplied = "Applied"
+	// ConditionTargetsDiscovered is False when the workloads of a target selector could not be listed.
+	ConditionTargetsDiscovered = "TargetsDiscovered"
+	// ConditionConflict is True when another IPA, HorizontalPodAutoscaler or
+	// VerticalPodAutoscaler manages one of the workloads, which IPA then leaves alone.
+	ConditionConflict = "Conflict"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Mode",type=string,JSONPath=`.spec.mode`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Applied",type=string,JSONPath=`.status.conditions[?(@.type=="Applied")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // IPA is the Schema for the ipas API.
 type IPA struct {
@@ -21,16 +21,171 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BasicAuth) DeepCopyInto(out *BasicAuth) {
+	*out = *in
+	in.Username.DeepCopyInto(&out.Username)
+	in.Password.DeepCopyInto(&out.Password)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BasicAuth.
+func (in *BasicAuth) DeepCopy() *BasicAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(BasicAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Clamp) DeepCopyInto(out *Clamp) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Clamp.
+func (in *Clamp) DeepCopy() *Clamp {
+	if in == nil {
+		return nil
+	}
+	out := new(Clamp)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerRecommendation) DeepCopyInto(out *ContainerRecommendation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerRecommendation.
+func (in *ContainerRecommendation) DeepCopy() *ContainerRecommendation {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerRecommendation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerSnapshot) DeepCopyInto(out *ContainerSnapshot) {
+	*out = *in
+	in.Resources.DeepCopyInto(&out.Resources)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerSnapshot.
+func (in *ContainerSnapshot) DeepCopy() *ContainerSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerUsage) DeepCopyInto(out *ContainerUsage) {
+	*out = *in
+	if in.CPUAvg != nil {
+		in, out := &in.CPUAvg, &out.CPUAvg
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.CPUP95 != nil {
+		in, out := &in.CPUP95, &out.CPUP95
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MemoryAvg != nil {
+		in, out := &in.MemoryAvg, &out.MemoryAvg
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MemoryP95 != nil {
+		in, out := &in.MemoryP95, &out.MemoryP95
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerUsage.
+func (in *ContainerUsage) DeepCopy() *ContainerUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Decision) DeepCopyInto(out *Decision) {
+	*out = *in
+	in.Recommendation.DeepCopyInto(&out.Recommendation)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Decision.
+func (in *Decision) DeepCopy() *Decision {
+	if in == nil {
+		return nil
+	}
+	out := new(Decision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EndpointAuth) DeepCopyInto(out *EndpointAuth) {
+	*out = *in
+	if in.BearerToken != nil {
+		in, out := &in.BearerToken, &out.BearerToken
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BasicAuth != nil {
+		in, out := &in.BasicAuth, &out.BasicAuth
+		*out = new(BasicAuth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make([]SecretHeader, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(TLSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EndpointAuth.
+func (in *EndpointAuth) DeepCopy() *EndpointAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(EndpointAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPA) DeepCopyInto(out *IPA) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPA.
@@ -54,6 +209,61 @@ func (in *IPA) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPAGroup) DeepCopyInto(out *IPAGroup) {
 	*out = *in
+	if in.ScaleTargetRef != nil {
+		in, out := &in.ScaleTargetRef, &out.ScaleTargetRef
+		*out = new(v2.CrossVersionObjectReference)
+		**out = **in
+	}
+	if in.TargetSelector != nil {
+		in, out := &in.TargetSelector, &out.TargetSelector
+		*out = new(TargetSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Queries != nil {
+		in, out := &in.Queries, &out.Queries
+		*out = make([]MetricQuery, len(*in))
+		copy(*out, *in)
+	}
+	if in.DisabledQueries != nil {
+		in, out := &in.DisabledQueries, &out.DisabledQueries
+		*out = make([]BuiltinQuery, len(*in))
+		copy(*out, *in)
+	}
+	if in.Window != nil {
+		in, out := &in.Window, &out.Window
+		*out = new(MetricsWindow)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExcludeContainers != nil {
+		in, out := &in.ExcludeContainers, &out.ExcludeContainers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(ResourceBounds)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StepLimits != nil {
+		in, out := &in.StepLimits, &out.StepLimits
+		*out = new(StepLimits)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Behavior != nil {
+		in, out := &in.Behavior, &out.Behavior
+		*out = new(ScalingBehavior)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAGroup.
@@ -66,6 +276,70 @@ func (in *IPAGroup) DeepCopy() *IPAGroup {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAGroupStatus) DeepCopyInto(out *IPAGroupStatus) {
+	*out = *in
+	out.ScaleTargetRef = in.ScaleTargetRef
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = new(MetricsSummary)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Recommendation != nil {
+		in, out := &in.Recommendation, &out.Recommendation
+		*out = new(Recommendation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Clamps != nil {
+		in, out := &in.Clamps, &out.Clamps
+		*out = make([]Clamp, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastScaleUpTime != nil {
+		in, out := &in.LastScaleUpTime, &out.LastScaleUpTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastScaleDownTime != nil {
+		in, out := &in.LastScaleDownTime, &out.LastScaleDownTime
+		*out = (*in).DeepCopy()
+	}
+	if in.RecentReplicas != nil {
+		in, out := &in.RecentReplicas, &out.RecentReplicas
+		*out = make([]TimedReplicas, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastAppliedTime != nil {
+		in, out := &in.LastAppliedTime, &out.LastAppliedTime
+		*out = (*in).DeepCopy()
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]Decision, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Original != nil {
+		in, out := &in.Original, &out.Original
+		*out = new(WorkloadSnapshot)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAGroupStatus.
+func (in *IPAGroupStatus) DeepCopy() *IPAGroupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAGroupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPAList) DeepCopyInto(out *IPAList) {
 	*out = *in
@@ -102,6 +376,21 @@ func (in *IPAList) DeepCopyObject() runtime.Object {
 func (in *IPASpec) DeepCopyInto(out *IPASpec) {
 	*out = *in
 	in.Metadata.DeepCopyInto(&out.Metadata)
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Parallelism != nil {
+		in, out := &in.Parallelism, &out.Parallelism
+		*out = new(int32)
+		**out = **in
+	}
+	if in.GroupTimeout != nil {
+		in, out := &in.GroupTimeout, &out.GroupTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPASpec.
@@ -117,6 +406,20 @@ func (in *IPASpec) DeepCopy() *IPASpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPAStatus) DeepCopyInto(out *IPAStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]IPAGroupStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAStatus.
@@ -129,13 +432,45 @@ func (in *IPAStatus) DeepCopy() *IPAStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressSummary) DeepCopyInto(out *IngressSummary) {
+	*out = *in
+	if in.LatencyP95 != nil {
+		in, out := &in.LatencyP95, &out.LatencyP95
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressSummary.
+func (in *IngressSummary) DeepCopy() *IngressSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Metadata) DeepCopyInto(out *Metadata) {
 	*out = *in
+	if in.PrometheusAuth != nil {
+		in, out := &in.PrometheusAuth, &out.PrometheusAuth
+		*out = new(EndpointAuth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LLMAgentAuth != nil {
+		in, out := &in.LLMAgentAuth, &out.LLMAgentAuth
+		*out = new(EndpointAuth)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.IPAGroup != nil {
 		in, out := &in.IPAGroup, &out.IPAGroup
 		*out = make([]IPAGroup, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
@@ -148,3 +483,328 @@ func (in *Metadata) DeepCopy() *Metadata {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricQuery) DeepCopyInto(out *MetricQuery) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricQuery.
+func (in *MetricQuery) DeepCopy() *MetricQuery {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricQuery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricsSummary) DeepCopyInto(out *MetricsSummary) {
+	*out = *in
+	if in.Containers != nil {
+		in, out := &in.Containers, &out.Containers
+		*out = make([]ContainerUsage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Ingress != nil {
+		in, out := &in.Ingress, &out.Ingress
+		*out = new(IngressSummary)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsSummary.
+func (in *MetricsSummary) DeepCopy() *MetricsSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricsSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricsWindow) DeepCopyInto(out *MetricsWindow) {
+	*out = *in
+	if in.Range != nil {
+		in, out := &in.Range, &out.Range
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Step != nil {
+		in, out := &in.Step, &out.Step
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RateWindow != nil {
+		in, out := &in.RateWindow, &out.RateWindow
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsWindow.
+func (in *MetricsWindow) DeepCopy() *MetricsWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricsWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuantityBounds) DeepCopyInto(out *QuantityBounds) {
+	*out = *in
+	if in.Min != nil {
+		in, out := &in.Min, &out.Min
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Max != nil {
+		in, out := &in.Max, &out.Max
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuantityBounds.
+func (in *QuantityBounds) DeepCopy() *QuantityBounds {
+	if in == nil {
+		return nil
+	}
+	out := new(QuantityBounds)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Recommendation) DeepCopyInto(out *Recommendation) {
+	*out = *in
+	if in.Containers != nil {
+		in, out := &in.Containers, &out.Containers
+		*out = make([]ContainerRecommendation, len(*in))
+		copy(*out, *in)
+	}
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Recommendation.
+func (in *Recommendation) DeepCopy() *Recommendation {
+	if in == nil {
+		return nil
+	}
+	out := new(Recommendation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceBounds) DeepCopyInto(out *ResourceBounds) {
+	*out = *in
+	if in.CPURequest != nil {
+		in, out := &in.CPURequest, &out.CPURequest
+		*out = new(QuantityBounds)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CPULimit != nil {
+		in, out := &in.CPULimit, &out.CPULimit
+		*out = new(QuantityBounds)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MemoryRequest != nil {
+		in, out := &in.MemoryRequest, &out.MemoryRequest
+		*out = new(QuantityBounds)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MemoryLimit != nil {
+		in, out := &in.MemoryLimit, &out.MemoryLimit
+		*out = new(QuantityBounds)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceBounds.
+func (in *ResourceBounds) DeepCopy() *ResourceBounds {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceBounds)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScalingBehavior) DeepCopyInto(out *ScalingBehavior) {
+	*out = *in
+	if in.ScaleUpCooldown != nil {
+		in, out := &in.ScaleUpCooldown, &out.ScaleUpCooldown
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ScaleDownCooldown != nil {
+		in, out := &in.ScaleDownCooldown, &out.ScaleDownCooldown
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.StabilizationWindow != nil {
+		in, out := &in.StabilizationWindow, &out.StabilizationWindow
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalingBehavior.
+func (in *ScalingBehavior) DeepCopy() *ScalingBehavior {
+	if in == nil {
+		return nil
+	}
+	out := new(ScalingBehavior)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretHeader) DeepCopyInto(out *SecretHeader) {
+	*out = *in
+	in.ValueFrom.DeepCopyInto(&out.ValueFrom)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretHeader.
+func (in *SecretHeader) DeepCopy() *SecretHeader {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretHeader)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StepLimits) DeepCopyInto(out *StepLimits) {
+	*out = *in
+	if in.MaxReplicaIncreasePercent != nil {
+		in, out := &in.MaxReplicaIncreasePercent, &out.MaxReplicaIncreasePercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxReplicaDecreasePercent != nil {
+		in, out := &in.MaxReplicaDecreasePercent, &out.MaxReplicaDecreasePercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxResourceIncreasePercent != nil {
+		in, out := &in.MaxResourceIncreasePercent, &out.MaxResourceIncreasePercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxResourceDecreasePercent != nil {
+		in, out := &in.MaxResourceDecreasePercent, &out.MaxResourceDecreasePercent
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StepLimits.
+func (in *StepLimits) DeepCopy() *StepLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(StepLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TLSConfig) DeepCopyInto(out *TLSConfig) {
+	*out = *in
+	if in.CA != nil {
+		in, out := &in.CA, &out.CA
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Cert != nil {
+		in, out := &in.Cert, &out.Cert
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Key != nil {
+		in, out := &in.Key, &out.Key
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLSConfig.
+func (in *TLSConfig) DeepCopy() *TLSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(TLSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetSelector) DeepCopyInto(out *TargetSelector) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Selector.DeepCopyInto(&out.Selector)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetSelector.
+func (in *TargetSelector) DeepCopy() *TargetSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TimedReplicas) DeepCopyInto(out *TimedReplicas) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimedReplicas.
+func (in *TimedReplicas) DeepCopy() *TimedReplicas {
+	if in == nil {
+		return nil
+	}
+	out := new(TimedReplicas)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkloadSnapshot) DeepCopyInto(out *WorkloadSnapshot) {
+	*out = *in
+	if in.Containers != nil {
+		in, out := &in.Containers, &out.Containers
+		*out = make([]ContainerSnapshot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkloadSnapshot.
+func (in *WorkloadSnapshot) DeepCopy() *WorkloadSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkloadSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
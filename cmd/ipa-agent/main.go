@@ -0,0 +1,65 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// ipa-agent serves the /askllm endpoint used by the IPA controller, backed by
+// an OpenAI-compatible or Anthropic LLM.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	agent "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+func main() {
+	var bindAddr string
+	var provider string
+	var llmURL string
+	var model string
+	flag.StringVar(&bindAddr, "bind-address", ":8080", "The address the agent API binds to.")
+	flag.StringVar(&provider, "provider", agent.ProviderOpenAI,
+		"The LLM backend protocol, either OpenAI or Anthropic. API keys are read from "+
+			"OPENAI_API_KEY or ANTHROPIC_API_KEY.")
+	flag.StringVar(&llmURL, "llm-url", "http://localhost:11434/v1", "The base URL of the LLM backend.")
+	flag.StringVar(&model, "model", "", "The model name sent to the LLM backend.")
+	flag.Parse()
+
+	if provider == agent.ProviderIPAAgent {
+		log.Fatalf("provider %s would forward to another agent, use OpenAI or Anthropic", provider)
+	}
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if provider == agent.ProviderAnthropic {
+		apiKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+	recommender, err := agent.NewRecommender(provider, llmURL, model, apiKey, nil)
+	if err != nil {
+		log.Fatalf("error creating recommender: %v", err)
+	}
+
+	server := &http.Server{
+		Addr:              bindAddr,
+		Handler:           agent.NewServer(recommender),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("starting ipa-agent on %s using %s at %s", bindAddr, provider, llmURL)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("error running ipa-agent: %v", err)
+	}
+}
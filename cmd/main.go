@@ -37,6 +37,7 @@ import (
 
 	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
 	"github.com/shafinhasnat/ipa/internal/controller"
+	webhookv1alpha1 "github.com/shafinhasnat/ipa/internal/webhook/v1alpha1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -58,6 +59,7 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var metricsFileDir string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -69,6 +71,8 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&metricsFileDir, "metrics-file-dir", "",
+		"The directory the StaticFile metrics source reads from. The source is disabled when empty.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -143,12 +147,23 @@ func main() {
 	}
 
 	if err = (&controller.IPAReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		Recorder:       mgr.GetEventRecorderFor("ipa-controller"),
+		APIReader:      mgr.GetAPIReader(),
+		MetricsFileDir: metricsFileDir,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "IPA")
 		os.Exit(1)
 	}
+	// The webhook server needs serving certificates, which are only mounted
+	// when config/webhook is deployed, so the webhooks are opt-in.
+	if os.Getenv("ENABLE_WEBHOOKS") == "true" {
+		if err = webhookv1alpha1.SetupIPAWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "IPA")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
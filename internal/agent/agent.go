@@ -1,135 +1,313 @@
 package controller
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
 )
 
-type LLMResponse struct {
-	Status  string `json:"status"`
-	Message string `json:"message"`
-	Config  Config `json:"text"`
-}
+type LLMResponse = agentv1.Response
+
+type Config = agentv1.Config
+
+type ContainerConfig = agentv1.ContainerConfig
 
-type Config struct {
-	Replicas      int32  `json:"replicas"`
-	CPULimit      string `json:"cpu_limit"`
-	CPURequest    string `json:"cpu_request"`
-	MemoryLimit   string `json:"memory_limit"`
-	MemoryRequest string `json:"memory_request"`
+// prometheusResponse is the body returned by /api/v1/query_range.
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		Result []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][2]any          `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
 }
 
-func PrometheusAPI(baseURL string, promql string, category string) (string, error) {
-	req, err := http.NewRequest("GET", baseURL, nil)
+// PrometheusAPI runs a range query over window. A nil client uses http.DefaultClient.
+func PrometheusAPI(ctx context.Context, client *http.Client, baseURL string, promql string, window Window) ([]agentv1.Series, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("error creating prometheus api request: %v", err)
+		return nil, fmt.Errorf("error creating prometheus api request: %v", err)
 	}
 	q := req.URL.Query()
 	q.Add("query", promql)
 
-	now := time.Now().UTC()
-	end := now.Format(time.RFC3339)
-	start := now.Add(-5 * time.Minute).Format(time.RFC3339)
+	end := time.Now().UTC().Add(-window.Offset)
+	start := end.Add(-window.Range)
 
-	q.Add("start", start)
-	q.Add("end", end)
-	q.Add("step", "60s")
+	q.Add("start", start.Format(time.RFC3339))
+	q.Add("end", end.Format(time.RFC3339))
+	q.Add("step", promDuration(window.Step))
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{}
+	if client == nil {
+		client = http.DefaultClient
+	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error sending prometheus api request: %v", err)
+		return nil, fmt.Errorf("error sending prometheus api request: %v", err)
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("error reading prometheus api response body: %v", err)
+		return nil, fmt.Errorf("error reading prometheus api response body: %v", err)
 	}
-	metrics := strings.ReplaceAll(string(body), `\`, "")
+	return parsePrometheusResponse(body)
+}
 
-	response := fmt.Sprintf("%s-\nPromQL: %s Metrics: %s\n", category, promql, metrics)
-	return response, nil
+// parsePrometheusResponse converts a range query response into series,
+// dropping samples that cannot be represented in JSON such as NaN.
+func parsePrometheusResponse(body []byte) ([]agentv1.Series, error) {
+	var response prometheusResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error unmarshalling prometheus api response: %v", err)
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("prometheus api returned status %q: %s", response.Status, response.Error)
+	}
+	series := make([]agentv1.Series, 0, len(response.Data.Result))
+	for _, result := range response.Data.Result {
+		samples := make([]agentv1.Sample, 0, len(result.Values))
+		for _, value := range result.Values {
+			timestamp, ok := value[0].(float64)
+			if !ok {
+				return nil, fmt.Errorf("unexpected prometheus timestamp: %v", value[0])
+			}
+			raw, ok := value[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("unexpected prometheus value: %v", value[1])
+			}
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing prometheus value %q: %v", raw, err)
+			}
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			samples = append(samples, agentv1.Sample{Timestamp: timestamp, Value: v})
+		}
+		series = append(series, agentv1.Series{Labels: result.Metric, Samples: samples})
+	}
+	return series, nil
 }
 
-func MetricsBuilder(prometheus string, deployment string, pods []string, namespace string, resourceInfo string, events []map[string]string, ingress string) (string, error) {
-	baseURL := fmt.Sprintf("%s/api/v1/query_range", prometheus)
+// Built-in query names, used in MetricsOptions.Disabled. Sources other than
+// Prometheus only support some of them.
+const (
+	QueryReplicas            = "replicas"
+	QueryCPUUsage            = "cpu_usage"
+	QueryMemoryUsage         = "memory_usage"
+	QueryNodeAvailableMemory = "node_available_memory"
+	QueryIngressRequests     = "ingress_requests"
+	QueryIngressErrorRatio   = "ingress_error_ratio"
+	// QueryIngressDuration covers the p50, p95 and p99 request durations.
+	QueryIngressDuration = "ingress_duration"
+)
 
-	podNames := strings.Join(pods, "|")
-	promql_deployment_replica := fmt.Sprintf("kube_deployment_spec_replicas{deployment=\"%s\", namespace=\"%s\"}", deployment, namespace)
-	deployment_replicas, err := PrometheusAPI(baseURL, promql_deployment_replica, "Deployment Replicas")
-	if err != nil {
-		return "", fmt.Errorf("error querying prometheus: %v, query: %s", err, promql_deployment_replica)
-	}
+// Metric names of built-in queries that differ from their query name. The
+// replica count is named after the target's kind and each ingress duration
+// after its quantile.
+const (
+	MetricDeploymentReplicas  = "deployment_replicas"
+	MetricStatefulSetReplicas = "statefulset_replicas"
+	MetricReplicaSetReplicas  = "replicaset_replicas"
+	MetricIngressDurationP50  = QueryIngressDuration + "_p50"
+	MetricIngressDurationP95  = QueryIngressDuration + "_p95"
+	MetricIngressDurationP99  = QueryIngressDuration + "_p99"
+)
 
-	promql_cpu_usage := fmt.Sprintf("rate(container_cpu_usage_seconds_total{pod=~\"%s\", namespace=\"%s\"}[2m])", podNames, namespace)
-	cpu_usage, err := PrometheusAPI(baseURL, promql_cpu_usage, "CPU Usage")
-	if err != nil {
-		return "", fmt.Errorf("error querying prometheus: %v, query: %s", err, promql_cpu_usage)
+// BuiltinMetrics returns the metric names of all built-in queries.
+func BuiltinMetrics() []string {
+	return []string{
+		MetricDeploymentReplicas, MetricStatefulSetReplicas, MetricReplicaSetReplicas,
+		QueryCPUUsage, QueryMemoryUsage, QueryNodeAvailableMemory,
+		QueryIngressRequests, QueryIngressErrorRatio,
+		MetricIngressDurationP50, MetricIngressDurationP95, MetricIngressDurationP99,
 	}
+}
 
-	promql_ram_usage := fmt.Sprintf("avg(container_memory_usage_bytes{pod=~\"%s\", namespace=\"%s\"})", podNames, namespace)
-	ram_usage, err := PrometheusAPI(baseURL, promql_ram_usage, "RAM Usage")
-	if err != nil {
-		return "", fmt.Errorf("error querying prometheus: %v, query: %s", err, promql_ram_usage)
-	}
+// Query is a named PromQL template. Templates can use {{.Namespace}},
+// {{.Deployment}}, which is the name of the target whatever its kind,
+// {{.Kind}}, {{.PodRegex}}, which matches the names of the target's pods, or
+// of any pod the target may have had in the context windows,
+// {{.Ingress}}, the name of the ingress in front of the target, and
+// {{.RateWindow}}, the range to use with rate() and similar functions.
+type Query struct {
+	Name     string
+	Template string
+}
 
-	promql_node_available_memory := "node_memory_MemAvailable_bytes"
-	node_available_memory, err := PrometheusAPI(baseURL, promql_node_available_memory, "Node Available Memory")
-	if err != nil {
-		return "", fmt.Errorf("error querying prometheus: %v, query: %s", err, promql_node_available_memory)
+// QueryData is the data a Query template is executed with.
+type QueryData struct {
+	Namespace  string
+	Deployment string
+	Kind       string
+	PodRegex   string
+	Ingress    string
+	RateWindow string
+}
+
+// Prometheus reads metrics from a Prometheus compatible query API, such as
+// Prometheus itself, Thanos or VictoriaMetrics. URL is the API base including
+// any path prefix, e.g. http://vmselect:8481/select/0/prometheus.
+type Prometheus struct {
+	URL string
+	// Client is used for every query. A nil client uses http.DefaultClient.
+	Client *http.Client
+}
+
+// Metrics queries Prometheus for the target of the request and adds the
+// results to its metrics and ingress fields. With MultiResolution every
+// query is also run, summarized, over each of ContextWindows.
+func (p *Prometheus) Metrics(ctx context.Context, request *agentv1.Request, options MetricsOptions) error {
+	baseURL := fmt.Sprintf("%s/api/v1/query_range", strings.TrimSuffix(p.URL, "/"))
+	window := options.Window.withDefaults()
+	rateWindow := options.RateWindow
+	if rateWindow <= 0 {
+		rateWindow = DefaultRateWindow
+	}
+	if err := p.collect(ctx, baseURL, request, options, window, rateWindow, false); err != nil {
+		return err
+	}
+	if options.MultiResolution {
+		for _, contextWindow := range ContextWindows {
+			// Every sample should cover its whole step, so rates widen to the step.
+			if err := p.collect(ctx, baseURL, request, options, contextWindow, max(rateWindow, contextWindow.Step), true); err != nil {
+				return err
+			}
+		}
 	}
 
-	promql_ingress_requests := fmt.Sprintf("sum(rate(nginx_ingress_controller_requests{ingress=\"%s\"}[2m]))", ingress)
-	ingress_requsts, err := PrometheusAPI(baseURL, promql_ingress_requests, "HTTP Request Rate")
-	if err != nil {
-		return "", fmt.Errorf("error querying prometheus: %v, query: %s", err, promql_ingress_requests)
+	return p.ingress(ctx, baseURL, request, options, window, rateWindow)
+}
+
+// collect runs the built-in and custom queries over window and adds them to
+// the request's metrics, summarizing them for context windows.
+func (p *Prometheus) collect(ctx context.Context, baseURL string, request *agentv1.Request, options MetricsOptions,
+	window Window, rateWindow time.Duration, summarized bool) error {
+	data := queryData(request, options, rateWindow)
+	if summarized {
+		// The pods of a day or a week ago had other names.
+		data.PodRegex = workloadPodRegex(request.Target)
 	}
+	namespace := data.Namespace
+	podNames := data.PodRegex
 
-	events_str := "Events of the pods-\n"
-	for _, event := range events {
-		events_str += fmt.Sprintf("Pod Name: %s, Event Type: %s, Event Reason: %s, Event Message: %s\n", event["pod"], event["type"], event["reason"], event["message"])
+	type query struct {
+		name   string
+		promql string
+		custom bool
+	}
+	var queries []query
+	if name, promql, ok := replicasQuery(request.Target); ok && !options.Disabled[QueryReplicas] {
+		queries = append(queries, query{name: name, promql: promql})
+	}
+	for _, builtin := range []query{
+		{name: QueryCPUUsage, promql: fmt.Sprintf("rate(container_cpu_usage_seconds_total{pod=~\"%s\", namespace=\"%s\", container!=\"\", container!=\"POD\"}[%s])", podNames, namespace, data.RateWindow)},
+		{name: QueryMemoryUsage, promql: fmt.Sprintf("avg by (container) (container_memory_usage_bytes{pod=~\"%s\", namespace=\"%s\", container!=\"\", container!=\"POD\"})", podNames, namespace)},
+		{name: QueryNodeAvailableMemory, promql: "node_memory_MemAvailable_bytes"},
+	} {
+		if !options.Disabled[builtin.name] {
+			queries = append(queries, builtin)
+		}
 	}
-	resourceInfo = fmt.Sprintf("Resource requests and limits-\n%s\n", resourceInfo)
-	response := fmt.Sprintf("%s%s%s%s%s%s%s", deployment_replicas, cpu_usage, ram_usage, node_available_memory, ingress_requsts, resourceInfo, events_str)
-	return string(response), nil
+	for _, custom := range options.Queries {
+		promql, err := RenderQuery(custom.Template, data)
+		if err != nil {
+			return fmt.Errorf("error rendering query %s: %v", custom.Name, err)
+		}
+		queries = append(queries, query{name: custom.Name, promql: promql, custom: true})
+	}
+	for _, query := range queries {
+		series, err := PrometheusAPI(ctx, p.Client, baseURL, query.promql, window)
+		if err != nil {
+			return fmt.Errorf("error querying prometheus: %v, query: %s", err, query.promql)
+		}
+		if summarized {
+			summarize(series)
+		}
+		request.Metrics = append(request.Metrics, agentv1.Metric{
+			Name:    query.name,
+			Query:   query.promql,
+			Custom:  query.custom,
+			Window:  window.wire(),
+			Context: summarized,
+			Series:  series,
+		})
+	}
+	return nil
 }
 
-func GeminiAPI(url string, prompt string) (LLMResponse, error) {
-	url = fmt.Sprintf("%s/askllm", url)
-
-	prompt = strings.ReplaceAll(prompt, "\n", "\\n")
-	prompt = strings.ReplaceAll(prompt, `"`, "")
+// queryData returns the data query templates are executed with for request.
+func queryData(request *agentv1.Request, options MetricsOptions, rateWindow time.Duration) QueryData {
+	return QueryData{
+		Namespace:  request.Target.Namespace,
+		Deployment: request.Target.Name,
+		Kind:       request.Target.Kind,
+		PodRegex:   strings.Join(options.Pods, "|"),
+		Ingress:    options.Ingress,
+		RateWindow: promDuration(rateWindow),
+	}
+}
 
-	payload := fmt.Sprintf(`{"metrics": "%s"}`, prompt)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(payload)))
-	if err != nil {
-		return LLMResponse{}, fmt.Errorf("error creating request: %v", err)
+// workloadPodRegex matches the names of every pod the target may have had,
+// following the naming of the controller that creates them.
+func workloadPodRegex(target agentv1.Target) string {
+	name := regexp.QuoteMeta(target.Name)
+	switch target.Kind {
+	case "Deployment", "Rollout":
+		return name + "-[a-z0-9]+-[a-z0-9]+"
+	case "StatefulSet":
+		return name + "-[0-9]+"
+	case "ReplicaSet":
+		return name + "-[a-z0-9]+"
 	}
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	return name + "-.*"
+}
+
+// RenderQuery executes a Query template with data.
+func RenderQuery(queryTemplate string, data QueryData) (string, error) {
+	tmpl, err := template.New("query").Option("missingkey=error").Parse(queryTemplate)
 	if err != nil {
-		return LLMResponse{}, fmt.Errorf("error sending request: %v", err)
+		return "", err
 	}
-	if resp.StatusCode != 200 {
-		return LLMResponse{}, fmt.Errorf("status code: %d", resp.StatusCode)
+	var promql strings.Builder
+	if err := tmpl.Execute(&promql, data); err != nil {
+		return "", err
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return LLMResponse{}, fmt.Errorf("error reading response body: %v", err)
+	return promql.String(), nil
+}
+
+// replicasQuery returns the kube-state-metrics query for the desired replica
+// count of the target, if kube-state-metrics exports one for its kind.
+func replicasQuery(target agentv1.Target) (string, string, bool) {
+	switch target.Kind {
+	case "Deployment":
+		return MetricDeploymentReplicas, fmt.Sprintf("kube_deployment_spec_replicas{deployment=\"%s\", namespace=\"%s\"}", target.Name, target.Namespace), true
+	case "StatefulSet":
+		return MetricStatefulSetReplicas, fmt.Sprintf("kube_statefulset_replicas{statefulset=\"%s\", namespace=\"%s\"}", target.Name, target.Namespace), true
+	case "ReplicaSet":
+		return MetricReplicaSetReplicas, fmt.Sprintf("kube_replicaset_spec_replicas{replicaset=\"%s\", namespace=\"%s\"}", target.Name, target.Namespace), true
 	}
+	return "", "", false
+}
 
+func GeminiAPI(ctx context.Context, client *http.Client, url string, request *agentv1.Request) (LLMResponse, error) {
+	url = fmt.Sprintf("%s/askllm", url)
 	var response LLMResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return LLMResponse{}, fmt.Errorf("error unmarshalling response: %v", err)
+	if err := postJSON(ctx, client, url, nil, request, &response); err != nil {
+		return LLMResponse{}, err
 	}
-	fmt.Println(response)
 	return response, nil
 }
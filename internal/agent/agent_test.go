@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+var _ = Describe("Prometheus", func() {
+	It("should parse range query results into numeric series", func() {
+		body := `{"status": "success", "data": {"resultType": "matrix", "result": [
+			{"metric": {"pod": "app-1", "container": "app"}, "values": [[1700000000, "0.5"], [1700000060, "NaN"], [1700000120, "1.25"]]}
+		]}}`
+		series, err := parsePrometheusResponse([]byte(body))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(series).To(Equal([]agentv1.Series{{
+			Labels:  map[string]string{"pod": "app-1", "container": "app"},
+			Samples: []agentv1.Sample{{Timestamp: 1700000000, Value: 0.5}, {Timestamp: 1700000120, Value: 1.25}},
+		}}))
+	})
+
+	It("should surface query errors", func() {
+		_, err := parsePrometheusResponse([]byte(`{"status": "error", "errorType": "bad_data", "error": "parse error"}`))
+		Expect(err).To(MatchError(ContainSubstring("parse error")))
+	})
+	It("should pick the replicas query for the target kind", func() {
+		name, promql, ok := replicasQuery(agentv1.Target{Kind: "StatefulSet", Name: "db", Namespace: "data"})
+		Expect(ok).To(BeTrue())
+		Expect(name).To(Equal(MetricStatefulSetReplicas))
+		Expect(promql).To(Equal(`kube_statefulset_replicas{statefulset="db", namespace="data"}`))
+		_, _, ok = replicasQuery(agentv1.Target{Kind: "Rollout", Name: "web", Namespace: "default"})
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should run custom queries and skip disabled built-in ones", func() {
+		var queries []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			queries = append(queries, r.URL.Query().Get("query"))
+			w.Write([]byte(`{"status": "success", "data": {"resultType": "matrix", "result": []}}`))
+		}))
+		defer server.Close()
+		request := agentv1.NewRequest(agentv1.Target{Kind: "Deployment", Name: "consumer", Namespace: "shop"})
+		source := &Prometheus{URL: server.URL + "/"}
+		err := source.Metrics(context.Background(), request, MetricsOptions{
+			Pods:     []string{"consumer-1", "consumer-2"},
+			Queries:  []Query{{Name: "lag", Template: `sum(kafka_consumergroup_lag{namespace="{{.Namespace}}", consumergroup="{{.Deployment}}"})`}},
+			Disabled: map[string]bool{QueryNodeAvailableMemory: true, QueryIngressRequests: true, QueryReplicas: true},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, metric := range request.Metrics {
+			names = append(names, metric.Name)
+		}
+		Expect(names).To(Equal([]string{"cpu_usage", "memory_usage", "lag"}))
+		Expect(request.Metrics[2].Custom).To(BeTrue())
+		Expect(queries[2]).To(Equal(`sum(kafka_consumergroup_lag{namespace="shop", consumergroup="consumer"})`))
+		Expect(request.Ingress).To(BeNil())
+	})
+
+	It("should query the traffic signals of the configured ingress controller", func() {
+		var queries []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			queries = append(queries, r.URL.Query().Get("query"))
+			w.Write([]byte(`{"status": "success", "data": {"resultType": "matrix", "result": [{"metric": {}, "values": [[1700000000, "0.5"]]}]}}`))
+		}))
+		defer server.Close()
+		source := &Prometheus{URL: server.URL}
+		disabled := map[string]bool{QueryReplicas: true, QueryCPUUsage: true, QueryMemoryUsage: true, QueryNodeAvailableMemory: true}
+
+		request := agentv1.NewRequest(agentv1.Target{Kind: "Deployment", Name: "web", Namespace: "shop"})
+		err := source.Metrics(context.Background(), request, MetricsOptions{Ingress: "web", IngressController: IngressContour, Disabled: disabled})
+		Expect(err).NotTo(HaveOccurred())
+		rq := `rate(envoy_cluster_upstream_rq_total{envoy_cluster_name=~"shop_web_.*"}[2m])`
+		buckets := `rate(envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name=~"shop_web_.*"}[2m])`
+		Expect(queries).To(Equal([]string{
+			"sum(" + rq + ")",
+			`(sum(rate(envoy_cluster_upstream_rq_xx{envoy_cluster_name=~"shop_web_.*", envoy_response_code_class="5"}[2m])) or vector(0)) / sum(` + rq + ")",
+			"histogram_quantile(0.5, sum by (le) (" + buckets + ")) * 0.001",
+			"histogram_quantile(0.95, sum by (le) (" + buckets + ")) * 0.001",
+			"histogram_quantile(0.99, sum by (le) (" + buckets + ")) * 0.001",
+		}))
+		Expect(request.Ingress.Controller).To(Equal(IngressContour))
+		Expect(request.Ingress.ErrorRatio).To(HaveLen(1))
+		Expect(request.Ingress.Duration.P99).To(HaveLen(1))
+
+		queries = nil
+		request = agentv1.NewRequest(agentv1.Target{Kind: "Deployment", Name: "web", Namespace: "shop"})
+		err = source.Metrics(context.Background(), request, MetricsOptions{Ingress: "web", IngressController: IngressHAProxy, Disabled: disabled})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queries).To(HaveLen(2))
+		Expect(request.Ingress.Duration).To(BeNil())
+
+		queries = nil
+		request = agentv1.NewRequest(agentv1.Target{Kind: "Deployment", Name: "web", Namespace: "shop"})
+		Expect(source.Metrics(context.Background(), request, MetricsOptions{Disabled: disabled})).To(Succeed())
+		Expect(queries).To(BeEmpty())
+		Expect(request.Ingress).To(BeNil())
+	})
+
+	It("should query the configured window and add summarized context", func() {
+		type received struct{ query, step string }
+		var queries []received
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			queries = append(queries, received{r.URL.Query().Get("query"), r.URL.Query().Get("step")})
+			w.Write([]byte(`{"status": "success", "data": {"resultType": "matrix", "result": [{"metric": {}, "values": [[1700000000, "1"], [1700000060, "3"]]}]}}`))
+		}))
+		defer server.Close()
+		request := agentv1.NewRequest(agentv1.Target{Kind: "Rollout", Name: "web", Namespace: "shop"})
+		source := &Prometheus{URL: server.URL}
+		err := source.Metrics(context.Background(), request, MetricsOptions{
+			Pods:            []string{"web-1"},
+			Disabled:        map[string]bool{QueryMemoryUsage: true, QueryNodeAvailableMemory: true, QueryIngressRequests: true},
+			Window:          Window{Range: time.Hour, Step: 30 * time.Second},
+			RateWindow:      5 * time.Minute,
+			MultiResolution: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queries).To(Equal([]received{
+			{`rate(container_cpu_usage_seconds_total{pod=~"web-1", namespace="shop", container!="", container!="POD"}[5m])`, "30s"},
+			{`rate(container_cpu_usage_seconds_total{pod=~"web-[a-z0-9]+-[a-z0-9]+", namespace="shop", container!="", container!="POD"}[5m])`, "30s"},
+			{`rate(container_cpu_usage_seconds_total{pod=~"web-[a-z0-9]+-[a-z0-9]+", namespace="shop", container!="", container!="POD"}[15m])`, "15m"},
+			{`rate(container_cpu_usage_seconds_total{pod=~"web-[a-z0-9]+-[a-z0-9]+", namespace="shop", container!="", container!="POD"}[5m])`, "5m"},
+		}))
+		Expect(request.Metrics).To(HaveLen(4))
+		Expect(request.Metrics[0].Window).To(Equal(&agentv1.Window{Range: "1h", Step: "30s"}))
+		Expect(request.Metrics[0].Context).To(BeFalse())
+		Expect(request.Metrics[0].Series[0].Summary).To(BeNil())
+		Expect(request.Metrics[3].Window).To(Equal(&agentv1.Window{Range: "1h", Step: "5m", Offset: "7d"}))
+		Expect(request.Metrics[3].Context).To(BeTrue())
+		Expect(request.Metrics[3].Series[0].Summary).To(Equal(&agentv1.Summary{Min: 1, Max: 3, Mean: 2, Last: 3, Count: 2}))
+	})
+
+	It("should match every pod a workload may have had in context windows", func() {
+		Expect(workloadPodRegex(agentv1.Target{Kind: "Deployment", Name: "web"})).To(Equal("web-[a-z0-9]+-[a-z0-9]+"))
+		Expect(workloadPodRegex(agentv1.Target{Kind: "StatefulSet", Name: "db"})).To(Equal("db-[0-9]+"))
+		Expect(workloadPodRegex(agentv1.Target{Kind: "CronTab", Name: "cron.v1"})).To(Equal(`cron\.v1-.*`))
+	})
+
+	It("should fail on templates that do not render", func() {
+		_, err := RenderQuery(`up{pod=~"{{.Pods}}"}`, QueryData{PodRegex: "app-1"})
+		Expect(err).To(HaveOccurred())
+		promql, err := RenderQuery(`up{pod=~"{{.PodRegex}}"}`, QueryData{PodRegex: "app-1|app-2"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(promql).To(Equal(`up{pod=~"app-1|app-2"}`))
+	})
+
+	It("should give up when the context is done", func() {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := PrometheusAPI(ctx, nil, server.URL, "up", DefaultWindow)
+		Expect(err).To(MatchError(ContainSubstring("context deadline exceeded")))
+	})
+})
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+// anthropicVersion is the Messages API version sent with every request.
+const anthropicVersion = "2023-06-01"
+
+// Anthropic talks to the Anthropic Messages API. URL is the API base, e.g.
+// https://api.anthropic.com.
+type Anthropic struct {
+	URL    string
+	Model  string
+	APIKey string
+	Client *http.Client
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    string             `json:"system"`
+	Messages  []anthropicMessage `json:"messages"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+func (a *Anthropic) Recommend(ctx context.Context, request *agentv1.Request) (LLMResponse, error) {
+	metrics, err := userPrompt(request)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	url := fmt.Sprintf("%s/v1/messages", strings.TrimSuffix(a.URL, "/"))
+	headers := map[string]string{"anthropic-version": anthropicVersion}
+	if a.APIKey != "" {
+		headers["x-api-key"] = a.APIKey
+	}
+	body := anthropicRequest{
+		Model:     a.Model,
+		MaxTokens: 1024,
+		System:    SystemPrompt,
+		Messages:  []anthropicMessage{{Role: "user", Content: metrics}},
+	}
+	var response anthropicResponse
+	if err := postJSON(ctx, a.Client, url, headers, body, &response); err != nil {
+		return LLMResponse{}, err
+	}
+	var text strings.Builder
+	for _, block := range response.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	config, err := parseConfig(text.String())
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	return LLMResponse{Status: "success", Message: text.String(), Config: config}, nil
+}
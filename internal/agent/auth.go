@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+)
+
+// Auth holds resolved credentials and TLS material for an HTTP endpoint.
+type Auth struct {
+	BearerToken string
+	Username    string
+	Password    string
+	Headers     map[string]string
+	// CA, Cert and Key are PEM encoded. Cert and Key are only used together.
+	CA   []byte
+	Cert []byte
+	Key  []byte
+}
+
+// NewHTTPClient returns a client that adds the credentials of auth to every
+// request, or no credentials when auth is nil. Clients with TLS settings get
+// their own transport, so callers should close their idle connections once
+// done with them.
+func NewHTTPClient(auth *Auth) (*http.Client, error) {
+	if auth == nil {
+		auth = &Auth{}
+	}
+	transport := &authTransport{auth: auth, base: http.DefaultTransport}
+	if len(auth.CA) > 0 || len(auth.Cert) > 0 {
+		tlsConfig, err := auth.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		base := http.DefaultTransport.(*http.Transport).Clone()
+		base.TLSClientConfig = tlsConfig
+		transport.base = base
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+func (a *Auth) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(a.CA) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(a.CA) {
+			return nil, fmt.Errorf("error parsing ca: no PEM certificates found")
+		}
+		config.RootCAs = pool
+	}
+	if len(a.Cert) > 0 {
+		certificate, err := tls.X509KeyPair(a.Cert, a.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// authTransport sets the credentials of auth on each request, replacing
+// headers of the same name set by the caller.
+type authTransport struct {
+	auth *Auth
+	base http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range t.auth.Headers {
+		req.Header.Set(name, value)
+	}
+	switch {
+	case t.auth.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+t.auth.BearerToken)
+	case t.auth.Username != "" || t.auth.Password != "":
+		req.SetBasicAuth(t.auth.Username, t.auth.Password)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of a transport created
+// for the client, leaving the shared default transport alone.
+func (t *authTransport) CloseIdleConnections() {
+	if t.base == http.DefaultTransport {
+		return
+	}
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Auth", func() {
+	var received http.Header
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	})
+
+	It("should add the credentials to every request", func() {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		client, err := NewHTTPClient(&Auth{BearerToken: "token", Headers: map[string]string{"X-Scope-OrgID": "team-a"}})
+		Expect(err).NotTo(HaveOccurred())
+		req, err := http.NewRequest("GET", server.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer from-env")
+		_, err = client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(received.Get("Authorization")).To(Equal("Bearer token"))
+		Expect(received.Get("X-Scope-OrgID")).To(Equal("team-a"))
+
+		client, err = NewHTTPClient(&Auth{Username: "ipa", Password: "secret"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(received.Get("Authorization")).To(Equal("Basic aXBhOnNlY3JldA=="))
+	})
+
+	It("should trust the configured CA", func() {
+		server := httptest.NewTLSServer(handler)
+		defer server.Close()
+		client, err := NewHTTPClient(nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.Get(server.URL)
+		Expect(err).To(HaveOccurred())
+
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		client, err = NewHTTPClient(&Auth{CA: ca})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.CloseIdleConnections()
+		_, err = client.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject malformed TLS material", func() {
+		_, err := NewHTTPClient(&Auth{CA: []byte("not a certificate")})
+		Expect(err).To(MatchError(ContainSubstring("error parsing ca")))
+		_, err = NewHTTPClient(&Auth{Cert: []byte("cert"), Key: []byte("key")})
+		Expect(err).To(MatchError(ContainSubstring("error parsing client certificate")))
+	})
+})
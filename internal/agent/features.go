@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+// saturationThreshold is the fraction of a limit at which a container is
+// flagged as near it.
+const saturationThreshold = 0.9
+
+// trendThreshold is the change over a window, relative to the average, below
+// which a metric is flat.
+const trendThreshold = 0.1
+
+// ContainerState is the state of a container across the target's pods.
+type ContainerState struct {
+	Restarts  int32
+	OOMKilled bool
+}
+
+// ExtractFeatures computes the features of the request's metrics, ingress
+// traffic and containers. states is keyed by container name.
+func ExtractFeatures(request *agentv1.Request, states map[string]ContainerState) *agentv1.Features {
+	features := &agentv1.Features{}
+	for _, metric := range request.Metrics {
+		features.Metrics = append(features.Metrics, metricFeatures(metric)...)
+	}
+	if ingress := request.Ingress; ingress != nil {
+		signals := []agentv1.Metric{
+			{Name: QueryIngressRequests, Series: ingress.RequestRate},
+			{Name: QueryIngressErrorRatio, Series: ingress.ErrorRatio},
+		}
+		if ingress.Duration != nil {
+			signals = append(signals,
+				agentv1.Metric{Name: MetricIngressDurationP50, Series: ingress.Duration.P50},
+				agentv1.Metric{Name: MetricIngressDurationP95, Series: ingress.Duration.P95},
+				agentv1.Metric{Name: MetricIngressDurationP99, Series: ingress.Duration.P99},
+			)
+		}
+		for _, signal := range signals {
+			features.Metrics = append(features.Metrics, metricFeatures(signal)...)
+		}
+	}
+	for _, container := range request.Spec.Containers {
+		features.Containers = append(features.Containers, containerFeatures(request.Metrics, container, states[container.Name]))
+	}
+	return features
+}
+
+// DropSeries removes the raw series from the request, leaving its features.
+func DropSeries(request *agentv1.Request) {
+	for i := range request.Metrics {
+		request.Metrics[i].Series = nil
+	}
+	if request.Ingress != nil {
+		request.Ingress.RequestRate = nil
+		request.Ingress.ErrorRatio = nil
+		request.Ingress.Duration = nil
+	}
+}
+
+// metricFeatures pools the series of metric by container, or describes them
+// one by one when they have no container label.
+func metricFeatures(metric agentv1.Metric) []agentv1.MetricFeatures {
+	var features []agentv1.MetricFeatures
+	var pooled [][]agentv1.Series
+	byContainer := map[string]int{}
+	for _, series := range metric.Series {
+		if len(series.Samples) == 0 {
+			continue
+		}
+		labels := series.Labels
+		if container, ok := series.Labels["container"]; ok {
+			if i, found := byContainer[container]; found {
+				pooled[i] = append(pooled[i], series)
+				continue
+			}
+			byContainer[container] = len(features)
+			labels = map[string]string{"container": container}
+		}
+		features = append(features, agentv1.MetricFeatures{
+			Name:    metric.Name,
+			Labels:  labels,
+			Custom:  metric.Custom,
+			Context: metric.Context,
+			Window:  metric.Window,
+		})
+		pooled = append(pooled, []agentv1.Series{series})
+	}
+	for i := range features {
+		features[i].Series = len(pooled[i])
+		features[i].Stats = stats(pooled[i])
+	}
+	return features
+}
+
+// containerFeatures returns the utilization and saturation of a container,
+// read from the cpu_usage and memory_usage metrics of the main window.
+func containerFeatures(metrics []agentv1.Metric, container agentv1.ContainerSpec, state ContainerState) agentv1.ContainerFeatures {
+	features := agentv1.ContainerFeatures{Name: container.Name, Restarts: state.Restarts}
+	for _, usage := range []struct {
+		metric      string
+		request     string
+		limit       string
+		utilization **agentv1.Utilization
+		overRequest string
+		nearLimit   string
+	}{
+		{QueryCPUUsage, container.CPURequest, container.CPULimit, &features.CPU, agentv1.SaturationCPURequest, agentv1.SaturationCPULimit},
+		{QueryMemoryUsage, container.MemoryRequest, container.MemoryLimit, &features.Memory, agentv1.SaturationMemoryRequest, agentv1.SaturationMemoryLimit},
+	} {
+		var samples []float64
+		for _, metric := range metrics {
+			if metric.Name != usage.metric || metric.Custom || metric.Context {
+				continue
+			}
+			for _, series := range metric.Series {
+				if series.Labels["container"] != container.Name {
+					continue
+				}
+				for _, sample := range series.Samples {
+					samples = append(samples, sample.Value)
+				}
+			}
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		sort.Float64s(samples)
+		utilization := &agentv1.Utilization{
+			Avg: round(mean(samples)),
+			P95: round(percentile(samples, 0.95)),
+			Max: round(samples[len(samples)-1]),
+		}
+		if request, ok := quantityValue(usage.request); ok && request > 0 {
+			utilization.P95OfRequest = round(percentile(samples, 0.95) / request)
+			if utilization.P95OfRequest > 1 {
+				features.Saturation = append(features.Saturation, usage.overRequest)
+			}
+		}
+		if limit, ok := quantityValue(usage.limit); ok && limit > 0 {
+			utilization.MaxOfLimit = round(samples[len(samples)-1] / limit)
+			if utilization.MaxOfLimit >= saturationThreshold {
+				features.Saturation = append(features.Saturation, usage.nearLimit)
+			}
+		}
+		*usage.utilization = utilization
+	}
+	if state.OOMKilled {
+		features.Saturation = append(features.Saturation, agentv1.SaturationOOMKilled)
+	}
+	return features
+}
+
+// stats returns the statistics of all samples of series.
+func stats(series []agentv1.Series) agentv1.Stats {
+	var values []float64
+	var last float64
+	for _, s := range series {
+		for _, sample := range s.Samples {
+			values = append(values, sample.Value)
+		}
+		last += s.Samples[len(s.Samples)-1].Value
+	}
+	slope, span := slopePerMinute(series)
+	average := mean(values)
+	result := agentv1.Stats{
+		Avg:     round(average),
+		Last:    round(last / float64(len(series))),
+		Slope:   round(slope),
+		Trend:   agentv1.TrendFlat,
+		Samples: len(values),
+	}
+	sort.Float64s(values)
+	result.Min = round(values[0])
+	result.Max = round(values[len(values)-1])
+	result.P95 = round(percentile(values, 0.95))
+	change := slope * span
+	if math.Abs(change) > trendThreshold*math.Abs(average) {
+		if change > 0 {
+			result.Trend = agentv1.TrendRising
+		} else {
+			result.Trend = agentv1.TrendFalling
+		}
+	}
+	return result
+}
+
+// slopePerMinute fits a least squares line through the samples of all series
+// and returns its slope per minute and the time span of the samples in minutes.
+// Times are taken relative to the first sample to keep the sums precise.
+func slopePerMinute(series []agentv1.Series) (float64, float64) {
+	origin := series[0].Samples[0].Timestamp
+	var n, sumX, sumY, sumXY, sumXX, first, last float64
+	for _, s := range series {
+		for _, sample := range s.Samples {
+			x := (sample.Timestamp - origin) / 60
+			n++
+			sumX += x
+			sumY += sample.Value
+			sumXY += x * sample.Value
+			sumXX += x * x
+			first = math.Min(first, x)
+			last = math.Max(last, x)
+		}
+	}
+	denominator := n*sumXX - sumX*sumX
+	if n < 2 || denominator == 0 {
+		return 0, 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator, last - first
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+// percentile returns the nearest-rank percentile p of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+// quantityValue parses a Kubernetes quantity, e.g. 250m or 256Mi.
+func quantityValue(value string) (float64, bool) {
+	if value == "" {
+		return 0, false
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, false
+	}
+	return quantity.AsApproximateFloat64(), true
+}
+
+// round keeps four significant digits, which is plenty for the agent and
+// keeps the document short.
+func round(value float64) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(value, 'g', 4, 64), 64)
+	return rounded
+}
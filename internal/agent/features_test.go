@@ -0,0 +1,87 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+var _ = Describe("Features", func() {
+	samples := func(values ...float64) []agentv1.Sample {
+		var samples []agentv1.Sample
+		for i, value := range values {
+			samples = append(samples, agentv1.Sample{Timestamp: float64(1700000000 + 60*i), Value: value})
+		}
+		return samples
+	}
+	request := func() *agentv1.Request {
+		request := agentv1.NewRequest(agentv1.Target{Kind: "Deployment", Name: "web", Namespace: "shop"})
+		request.Spec.Containers = []agentv1.ContainerSpec{
+			{Name: "app", CPURequest: "100m", CPULimit: "500m", MemoryRequest: "100Mi", MemoryLimit: "200Mi"},
+			{Name: "sidecar"},
+		}
+		request.Metrics = []agentv1.Metric{
+			{Name: QueryCPUUsage, Series: []agentv1.Series{
+				{Labels: map[string]string{"pod": "web-1", "container": "app"}, Samples: samples(0.1, 0.2, 0.3, 0.4)},
+				{Labels: map[string]string{"pod": "web-2", "container": "app"}, Samples: samples(0.1, 0.2, 0.3, 0.46)},
+				{Labels: map[string]string{"pod": "web-1", "container": "sidecar"}, Samples: samples(0.01, 0.01)},
+			}},
+			{Name: QueryMemoryUsage, Series: []agentv1.Series{
+				{Labels: map[string]string{"container": "app"}, Samples: samples(80<<20, 80<<20)},
+			}},
+			{Name: QueryNodeAvailableMemory, Series: []agentv1.Series{
+				{Labels: map[string]string{"node": "a"}, Samples: samples(4e9, 3e9, 2e9)},
+				{Labels: map[string]string{"node": "b"}, Samples: []agentv1.Sample{}},
+			}},
+		}
+		request.Ingress = &agentv1.Ingress{Name: "web", RequestRate: []agentv1.Series{{Samples: samples(10, 10, 10)}}}
+		return request
+	}
+
+	It("should pool series by container and describe the others one by one", func() {
+		features := ExtractFeatures(request(), nil)
+		Expect(features.Metrics).To(Equal([]agentv1.MetricFeatures{
+			{Name: QueryCPUUsage, Labels: map[string]string{"container": "app"}, Series: 2, Stats: agentv1.Stats{
+				Min: 0.1, Avg: 0.2575, Max: 0.46, P95: 0.46, Last: 0.43, Slope: 0.109, Trend: agentv1.TrendRising, Samples: 8,
+			}},
+			{Name: QueryCPUUsage, Labels: map[string]string{"container": "sidecar"}, Series: 1, Stats: agentv1.Stats{
+				Min: 0.01, Avg: 0.01, Max: 0.01, P95: 0.01, Last: 0.01, Trend: agentv1.TrendFlat, Samples: 2,
+			}},
+			{Name: QueryMemoryUsage, Labels: map[string]string{"container": "app"}, Series: 1, Stats: agentv1.Stats{
+				Min: 83890000, Avg: 83890000, Max: 83890000, P95: 83890000, Last: 83890000, Trend: agentv1.TrendFlat, Samples: 2,
+			}},
+			{Name: QueryNodeAvailableMemory, Labels: map[string]string{"node": "a"}, Series: 1, Stats: agentv1.Stats{
+				Min: 2e9, Avg: 3e9, Max: 4e9, P95: 4e9, Last: 2e9, Slope: -1e9, Trend: agentv1.TrendFalling, Samples: 3,
+			}},
+			{Name: "ingress_requests", Series: 1, Stats: agentv1.Stats{
+				Min: 10, Avg: 10, Max: 10, P95: 10, Last: 10, Trend: agentv1.TrendFlat, Samples: 3,
+			}},
+		}))
+	})
+
+	It("should relate usage to requests and limits and flag saturation", func() {
+		features := ExtractFeatures(request(), map[string]ContainerState{"app": {Restarts: 3, OOMKilled: true}})
+		Expect(features.Containers).To(Equal([]agentv1.ContainerFeatures{
+			{
+				Name:     "app",
+				CPU:      &agentv1.Utilization{Avg: 0.2575, P95: 0.46, Max: 0.46, P95OfRequest: 4.6, MaxOfLimit: 0.92},
+				Memory:   &agentv1.Utilization{Avg: 83890000, P95: 83890000, Max: 83890000, P95OfRequest: 0.8, MaxOfLimit: 0.4},
+				Restarts: 3,
+				Saturation: []string{
+					agentv1.SaturationCPURequest, agentv1.SaturationCPULimit, agentv1.SaturationOOMKilled,
+				},
+			},
+			{Name: "sidecar", CPU: &agentv1.Utilization{Avg: 0.01, P95: 0.01, Max: 0.01}},
+		}))
+	})
+
+	It("should drop the raw series", func() {
+		r := request()
+		DropSeries(r)
+		for _, metric := range r.Metrics {
+			Expect(metric.Series).To(BeNil())
+		}
+		Expect(r.Ingress.RequestRate).To(BeNil())
+	})
+})
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+// Supported ingress controllers, used in MetricsOptions.IngressController.
+const (
+	IngressNginx      = "Nginx"
+	IngressTraefik    = "Traefik"
+	IngressHAProxy    = "HAProxy"
+	IngressContour    = "Contour"
+	IngressGatewayAPI = "GatewayAPI"
+)
+
+// ingressQueries are the PromQL templates of an ingress controller, executed
+// with QueryData. Each is a per-series rate that the built-in queries sum.
+type ingressQueries struct {
+	// requests is the rate of all requests.
+	requests string
+	// errors is the rate of requests answered with a 5xx status.
+	errors string
+	// durationBuckets is the rate of the request duration histogram buckets,
+	// empty when the controller exports none.
+	durationBuckets string
+	// durationUnit is the length of the histogram's unit in seconds.
+	durationUnit float64
+}
+
+// envoyQueries reads the Envoy cluster metrics selected by clusterName, a
+// regular expression template.
+func envoyQueries(clusterName string) ingressQueries {
+	selector := fmt.Sprintf("envoy_cluster_name=~\"%s\"", clusterName)
+	return ingressQueries{
+		requests:        fmt.Sprintf("rate(envoy_cluster_upstream_rq_total{%s}[{{.RateWindow}}])", selector),
+		errors:          fmt.Sprintf("rate(envoy_cluster_upstream_rq_xx{%s, envoy_response_code_class=\"5\"}[{{.RateWindow}}])", selector),
+		durationBuckets: fmt.Sprintf("rate(envoy_cluster_upstream_rq_time_bucket{%s}[{{.RateWindow}}])", selector),
+		durationUnit:    0.001,
+	}
+}
+
+// ingressControllers holds the queries of each supported ingress controller.
+// Nginx labels requests with the ingress namespace, which Prometheus renames
+// to exported_namespace when scraping the controller. Contour names clusters
+// namespace_service_port and Envoy Gateway names them
+// httproute/namespace/name/rule/index.
+var ingressControllers = map[string]ingressQueries{
+	IngressNginx: {
+		requests:        "rate(nginx_ingress_controller_requests{exported_namespace=\"{{.Namespace}}\", ingress=\"{{.Ingress}}\"}[{{.RateWindow}}])",
+		errors:          "rate(nginx_ingress_controller_requests{exported_namespace=\"{{.Namespace}}\", ingress=\"{{.Ingress}}\", status=~\"5..\"}[{{.RateWindow}}])",
+		durationBuckets: "rate(nginx_ingress_controller_request_duration_seconds_bucket{exported_namespace=\"{{.Namespace}}\", ingress=\"{{.Ingress}}\"}[{{.RateWindow}}])",
+		durationUnit:    1,
+	},
+	IngressTraefik: {
+		requests:        "rate(traefik_router_requests_total{router=~\"{{.Namespace}}-{{.Ingress}}-.*@kubernetes\"}[{{.RateWindow}}])",
+		errors:          "rate(traefik_router_requests_total{router=~\"{{.Namespace}}-{{.Ingress}}-.*@kubernetes\", code=~\"5..\"}[{{.RateWindow}}])",
+		durationBuckets: "rate(traefik_router_request_duration_seconds_bucket{router=~\"{{.Namespace}}-{{.Ingress}}-.*@kubernetes\"}[{{.RateWindow}}])",
+		durationUnit:    1,
+	},
+	IngressHAProxy: {
+		requests: "rate(haproxy_backend_http_requests_total{proxy=~\"{{.Namespace}}_{{.Ingress}}_.*\"}[{{.RateWindow}}])",
+		errors:   "rate(haproxy_backend_http_responses_total{proxy=~\"{{.Namespace}}_{{.Ingress}}_.*\", code=\"5xx\"}[{{.RateWindow}}])",
+	},
+	IngressContour:    envoyQueries("{{.Namespace}}_{{.Ingress}}_.*"),
+	IngressGatewayAPI: envoyQueries("httproute/{{.Namespace}}/{{.Ingress}}/.*"),
+}
+
+// durationQuantiles are the request duration quantiles sent to the agent.
+var durationQuantiles = []float64{0.5, 0.95, 0.99}
+
+// ingress queries the request rate, 5xx ratio and request duration quantiles
+// of the ingress in options and sets them on the request. It does nothing
+// when no ingress is configured.
+func (p *Prometheus) ingress(ctx context.Context, baseURL string, request *agentv1.Request, options MetricsOptions,
+	window Window, rateWindow time.Duration) error {
+	if options.Ingress == "" {
+		return nil
+	}
+	name := options.IngressController
+	if name == "" {
+		name = IngressNginx
+	}
+	queries, ok := ingressControllers[name]
+	if !ok {
+		return fmt.Errorf("unknown ingress controller: %s", name)
+	}
+	data := queryData(request, options, rateWindow)
+	requests, err := RenderQuery(queries.requests, data)
+	if err != nil {
+		return fmt.Errorf("error rendering ingress requests query: %v", err)
+	}
+	ingress := &agentv1.Ingress{Name: options.Ingress, Controller: name}
+	query := func(promql string) ([]agentv1.Series, error) {
+		series, err := PrometheusAPI(ctx, p.Client, baseURL, promql, window)
+		if err != nil {
+			return nil, fmt.Errorf("error querying prometheus: %v, query: %s", err, promql)
+		}
+		return series, nil
+	}
+
+	if !options.Disabled[QueryIngressRequests] {
+		if ingress.RequestRate, err = query(fmt.Sprintf("sum(%s)", requests)); err != nil {
+			return err
+		}
+	}
+	if !options.Disabled[QueryIngressErrorRatio] {
+		failures, err := RenderQuery(queries.errors, data)
+		if err != nil {
+			return fmt.Errorf("error rendering ingress errors query: %v", err)
+		}
+		// Without any 5xx series the ratio is 0 rather than an empty result.
+		if ingress.ErrorRatio, err = query(fmt.Sprintf("(sum(%s) or vector(0)) / sum(%s)", failures, requests)); err != nil {
+			return err
+		}
+	}
+	if !options.Disabled[QueryIngressDuration] && queries.durationBuckets != "" {
+		buckets, err := RenderQuery(queries.durationBuckets, data)
+		if err != nil {
+			return fmt.Errorf("error rendering ingress duration query: %v", err)
+		}
+		ingress.Duration = &agentv1.RequestDuration{}
+		for i, quantile := range []*[]agentv1.Series{&ingress.Duration.P50, &ingress.Duration.P95, &ingress.Duration.P99} {
+			promql := fmt.Sprintf("histogram_quantile(%g, sum by (le) (%s))", durationQuantiles[i], buckets)
+			if queries.durationUnit != 1 {
+				promql = fmt.Sprintf("%s * %g", promql, queries.durationUnit)
+			}
+			if *quantile, err = query(promql); err != nil {
+				return err
+			}
+		}
+	}
+	if ingress.RequestRate != nil || ingress.ErrorRatio != nil || ingress.Duration != nil {
+		request.Ingress = ingress
+	}
+	return nil
+}
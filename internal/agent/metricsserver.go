@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+// podMetricsListKind is the list kind served by metrics-server.
+var podMetricsListKind = schema.GroupVersionKind{Group: "metrics.k8s.io", Version: "v1beta1", Kind: "PodMetricsList"}
+
+// MetricsServer reads the current CPU and memory usage of the target's pods
+// from the metrics.k8s.io API served by metrics-server. It has no history,
+// so each series holds a single sample, and it has no ingress or replica
+// signals. Custom queries are not supported.
+type MetricsServer struct {
+	// Reader must not be backed by a cache, since the metrics API cannot be watched.
+	Reader client.Reader
+}
+
+func (m *MetricsServer) Metrics(ctx context.Context, request *agentv1.Request, options MetricsOptions) error {
+	if len(options.Queries) > 0 {
+		return fmt.Errorf("custom queries need a Prometheus metrics source")
+	}
+	podMetricsList := &unstructured.UnstructuredList{}
+	podMetricsList.SetGroupVersionKind(podMetricsListKind)
+	if err := m.Reader.List(ctx, podMetricsList, client.InNamespace(request.Target.Namespace)); err != nil {
+		return fmt.Errorf("error listing pod metrics: %v", err)
+	}
+	pods := map[string]bool{}
+	for _, pod := range options.Pods {
+		pods[pod] = true
+	}
+	cpu := agentv1.Metric{Name: QueryCPUUsage, Series: []agentv1.Series{}}
+	memory := agentv1.Metric{Name: QueryMemoryUsage, Series: []agentv1.Series{}}
+	for _, podMetrics := range podMetricsList.Items {
+		if !pods[podMetrics.GetName()] {
+			continue
+		}
+		timestamp, _, _ := unstructured.NestedString(podMetrics.Object, "timestamp")
+		sampleTime, err := time.Parse(time.RFC3339, timestamp)
+		if err != nil {
+			return fmt.Errorf("error parsing pod metrics timestamp %q: %v", timestamp, err)
+		}
+		containers, _, _ := unstructured.NestedSlice(podMetrics.Object, "containers")
+		for _, item := range containers {
+			container, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(container, "name")
+			labels := map[string]string{"pod": podMetrics.GetName(), "container": name}
+			for _, usage := range []struct {
+				metric   *agentv1.Metric
+				resource string
+				value    func(resource.Quantity) float64
+			}{
+				{&cpu, "cpu", func(q resource.Quantity) float64 { return float64(q.MilliValue()) / 1000 }},
+				{&memory, "memory", func(q resource.Quantity) float64 { return float64(q.Value()) }},
+			} {
+				raw, found, _ := unstructured.NestedString(container, "usage", usage.resource)
+				if !found {
+					continue
+				}
+				quantity, err := resource.ParseQuantity(raw)
+				if err != nil {
+					return fmt.Errorf("error parsing %s usage %q: %v", usage.resource, raw, err)
+				}
+				usage.metric.Series = append(usage.metric.Series, agentv1.Series{
+					Labels:  labels,
+					Samples: []agentv1.Sample{{Timestamp: float64(sampleTime.Unix()), Value: usage.value(quantity)}},
+				})
+			}
+		}
+	}
+	for _, metric := range []agentv1.Metric{cpu, memory} {
+		if !options.Disabled[metric.Name] {
+			request.Metrics = append(request.Metrics, metric)
+		}
+	}
+	return nil
+}
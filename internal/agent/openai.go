@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+// OpenAI talks to an OpenAI-compatible chat completions endpoint, such as
+// the ones served by vLLM, Ollama or LM Studio. URL is the API base, e.g.
+// http://localhost:11434/v1.
+type OpenAI struct {
+	URL    string
+	Model  string
+	APIKey string
+	Client *http.Client
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func (o *OpenAI) Recommend(ctx context.Context, request *agentv1.Request) (LLMResponse, error) {
+	metrics, err := userPrompt(request)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	url := fmt.Sprintf("%s/chat/completions", strings.TrimSuffix(o.URL, "/"))
+	headers := map[string]string{}
+	if o.APIKey != "" {
+		headers["Authorization"] = "Bearer " + o.APIKey
+	}
+	body := openAIRequest{
+		Model: o.Model,
+		Messages: []openAIMessage{
+			{Role: "system", Content: SystemPrompt},
+			{Role: "user", Content: metrics},
+		},
+	}
+	var response openAIResponse
+	if err := postJSON(ctx, o.Client, url, headers, body, &response); err != nil {
+		return LLMResponse{}, err
+	}
+	if len(response.Choices) == 0 {
+		return LLMResponse{}, fmt.Errorf("no choices in chat completion response")
+	}
+	text := response.Choices[0].Message.Content
+	config, err := parseConfig(text)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	return LLMResponse{Status: "success", Message: text, Config: config}, nil
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+// Recommender turns a request document into a scaling recommendation.
+type Recommender interface {
+	Recommend(ctx context.Context, request *agentv1.Request) (LLMResponse, error)
+}
+
+// Supported LLM providers.
+const (
+	ProviderIPAAgent  = "IPAAgent"
+	ProviderOpenAI    = "OpenAI"
+	ProviderAnthropic = "Anthropic"
+)
+
+// SystemPrompt instructs chat-style models to answer with a Config document.
+const SystemPrompt = `You are a Kubernetes autoscaling assistant. You are given a JSON document with the current spec, metric series, events and ingress traffic (request rate, 5xx error ratio and request duration quantiles) of a single deployment.
+Decide the number of replicas and the CPU and memory requests and limits for each container listed in spec.containers.
+The features section summarizes every metric (min, avg, max, p95, slope per minute and trend) and every container: usage relative to its current request and limit, restarts and saturation flags. Raw metric series are only included when requested; per-container series carry a container label.
+Respond with a single JSON object and nothing else, using exactly these keys:
+{"replicas": <integer>, "containers": {"<container name>": {"cpu_request": "<quantity>", "cpu_limit": "<quantity>", "memory_request": "<quantity>", "memory_limit": "<quantity>"}}}
+Include an entry for every container in spec.containers.
+Quantities use Kubernetes notation, e.g. "250m" for CPU and "256Mi" for memory.`
+
+// NewRecommender returns the Recommender for the given provider. An empty
+// provider selects the IPA agent protocol, and a nil client uses
+// http.DefaultClient. apiKey is sent to OpenAI and Anthropic endpoints when
+// it is not empty.
+func NewRecommender(provider string, url string, model string, apiKey string, client *http.Client) (Recommender, error) {
+	switch provider {
+	case "", ProviderIPAAgent:
+		return &IPAAgent{URL: url, Client: client}, nil
+	case ProviderOpenAI:
+		return &OpenAI{URL: url, Model: model, APIKey: apiKey, Client: client}, nil
+	case ProviderAnthropic:
+		return &Anthropic{URL: url, Model: model, APIKey: apiKey, Client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown llm provider: %s", provider)
+	}
+}
+
+// IPAAgent talks to an IPA agent serving the /askllm endpoint.
+type IPAAgent struct {
+	URL    string
+	Client *http.Client
+}
+
+func (a *IPAAgent) Recommend(ctx context.Context, request *agentv1.Request) (LLMResponse, error) {
+	return GeminiAPI(ctx, a.Client, a.URL, request)
+}
+
+// userPrompt encodes the request document as the user message for chat models.
+func userPrompt(request *agentv1.Request) (string, error) {
+	prompt, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling request: %v", err)
+	}
+	return string(prompt), nil
+}
+
+// postJSON sends body as JSON to url and decodes the JSON response into out.
+// A nil client uses http.DefaultClient.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body any, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error marshalling request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("status code: %d, body: %s", resp.StatusCode, respBody)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("error unmarshalling response: %v", err)
+	}
+	return nil
+}
+
+// parseConfig extracts the Config JSON object from a model's text answer,
+// tolerating surrounding prose or markdown code fences.
+func parseConfig(text string) (Config, error) {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return Config{}, fmt.Errorf("no json object in model response: %s", text)
+	}
+	var config Config
+	if err := json.Unmarshal([]byte(text[start:end+1]), &config); err != nil {
+		return Config{}, fmt.Errorf("error unmarshalling model response: %v", err)
+	}
+	return config, nil
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+var _ = Describe("Recommender", func() {
+	var (
+		server   *httptest.Server
+		path     string
+		headers  http.Header
+		received map[string]any
+		reply    string
+		request  = agentv1.NewRequest(agentv1.Target{Kind: "Deployment", Name: "app", Namespace: "default"})
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			headers = r.Header.Clone()
+			received = map[string]any{}
+			Expect(json.NewDecoder(r.Body).Decode(&received)).To(Succeed())
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(reply))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should speak the IPA agent protocol", func() {
+		reply = `{"status": "success", "message": "ok", "text": {"replicas": 3, "cpu_request": "100m", "cpu_limit": "200m", "memory_request": "128Mi", "memory_limit": "256Mi"}}`
+		recommender, err := NewRecommender("", server.URL, "", "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		response, err := recommender.Recommend(context.Background(), request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(path).To(Equal("/askllm"))
+		Expect(received["apiVersion"]).To(Equal(agentv1.Version))
+		Expect(response.Config.Replicas).To(Equal(int32(3)))
+	})
+
+	It("should speak the OpenAI chat completions protocol", func() {
+		reply = `{"choices": [{"message": {"role": "assistant", "content": "` + "```json\\n" + `{\"replicas\": 2, \"cpu_request\": \"100m\", \"cpu_limit\": \"1\", \"memory_request\": \"64Mi\", \"memory_limit\": \"1Gi\"}` + "\\n```" + `"}}]}`
+		recommender := &OpenAI{URL: server.URL + "/v1", Model: "llama3", APIKey: "secret"}
+		response, err := recommender.Recommend(context.Background(), request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(path).To(Equal("/v1/chat/completions"))
+		Expect(headers.Get("Authorization")).To(Equal("Bearer secret"))
+		Expect(received["model"]).To(Equal("llama3"))
+		Expect(response.Config.Replicas).To(Equal(int32(2)))
+		Expect(response.Config.MemoryLimit).To(Equal("1Gi"))
+	})
+
+	It("should speak the Anthropic Messages protocol", func() {
+		reply = `{"content": [{"type": "text", "text": "{\"replicas\": 4, \"cpu_request\": \"250m\", \"cpu_limit\": \"500m\", \"memory_request\": \"256Mi\", \"memory_limit\": \"512Mi\"}"}]}`
+		recommender := &Anthropic{URL: server.URL, Model: "claude", APIKey: "secret"}
+		response, err := recommender.Recommend(context.Background(), request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(path).To(Equal("/v1/messages"))
+		Expect(headers.Get("x-api-key")).To(Equal("secret"))
+		Expect(headers.Get("anthropic-version")).To(Equal(anthropicVersion))
+		Expect(received["system"]).To(Equal(SystemPrompt))
+		Expect(response.Config.Replicas).To(Equal(int32(4)))
+	})
+
+	It("should reject unknown providers", func() {
+		_, err := NewRecommender("Unknown", server.URL, "", "", nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+// Server implements the IPA agent HTTP API on top of a Recommender.
+type Server struct {
+	Recommender Recommender
+	mux         *http.ServeMux
+}
+
+// NewServer returns a Server that answers /askllm with recommendations from
+// the given Recommender.
+func NewServer(recommender Recommender) *Server {
+	s := &Server{Recommender: recommender, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/askllm", s.askLLM)
+	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) askLLM(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeResponse(w, http.StatusMethodNotAllowed, LLMResponse{Status: "error", Message: "only POST is allowed"})
+		return
+	}
+	var request agentv1.Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeResponse(w, http.StatusBadRequest, LLMResponse{Status: "error", Message: fmt.Sprintf("error decoding request: %v", err)})
+		return
+	}
+	if request.APIVersion != agentv1.Version {
+		writeResponse(w, http.StatusBadRequest, LLMResponse{Status: "error", Message: fmt.Sprintf("unsupported apiVersion %q, expected %q", request.APIVersion, agentv1.Version)})
+		return
+	}
+	response, err := s.Recommender.Recommend(r.Context(), &request)
+	if err != nil {
+		log.Printf("error querying llm: %v", err)
+		writeResponse(w, http.StatusBadGateway, LLMResponse{Status: "error", Message: fmt.Sprintf("error querying llm: %v", err)})
+		return
+	}
+	if err := ValidateConfig(response.Config); err != nil {
+		log.Printf("invalid recommendation: %v", err)
+		writeResponse(w, http.StatusUnprocessableEntity, LLMResponse{Status: "error", Message: fmt.Sprintf("invalid recommendation: %v", err)})
+		return
+	}
+	writeResponse(w, http.StatusOK, response)
+}
+
+func writeResponse(w http.ResponseWriter, status int, response LLMResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("error writing response: %v", err)
+	}
+}
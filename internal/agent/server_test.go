@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+type fakeRecommender struct {
+	response LLMResponse
+	err      error
+	request  *agentv1.Request
+}
+
+func (f *fakeRecommender) Recommend(ctx context.Context, request *agentv1.Request) (LLMResponse, error) {
+	f.request = request
+	return f.response, f.err
+}
+
+var _ = Describe("Server", func() {
+	var (
+		recommender *fakeRecommender
+		server      *httptest.Server
+	)
+
+	BeforeEach(func() {
+		recommender = &fakeRecommender{}
+		server = httptest.NewServer(NewServer(recommender))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should serve the contract GeminiAPI expects", func() {
+		recommender.response = LLMResponse{Status: "success", Message: "scale up", Config: Config{
+			Replicas: 3, CPURequest: "100m", CPULimit: "200m", MemoryRequest: "128Mi", MemoryLimit: "256Mi",
+		}}
+		request := agentv1.NewRequest(agentv1.Target{Kind: "Deployment", Name: "app", Namespace: "default"})
+		request.Events = []agentv1.Event{{Pod: "app-1", Type: "Warning", Reason: "BackOff", Message: `Back-off restarting failed container "app"\n`}}
+		request.Metrics = []agentv1.Metric{{Name: "cpu_usage", Series: []agentv1.Series{{Samples: []agentv1.Sample{{Timestamp: 1, Value: 0.25}}}}}}
+		response, err := GeminiAPI(context.Background(), nil, server.URL, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recommender.request).To(Equal(request))
+		Expect(response).To(Equal(recommender.response))
+	})
+
+	It("should reject recommendations that fail validation", func() {
+		recommender.response = LLMResponse{Status: "success", Config: Config{
+			Replicas: 0, CPURequest: "100m", CPULimit: "200m", MemoryRequest: "128Mi", MemoryLimit: "256Mi",
+		}}
+		body := `{"apiVersion": "` + agentv1.Version + `", "target": {"kind": "Deployment", "name": "app", "namespace": "default"}}`
+		resp, err := http.Post(server.URL+"/askllm", "application/json", bytes.NewBufferString(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnprocessableEntity))
+		var response LLMResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&response)).To(Succeed())
+		Expect(response.Status).To(Equal("error"))
+	})
+
+	It("should report backend failures", func() {
+		recommender.err = fmt.Errorf("connection refused")
+		_, err := GeminiAPI(context.Background(), nil, server.URL, agentv1.NewRequest(agentv1.Target{Name: "app"}))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject documents without the expected apiVersion", func() {
+		resp, err := http.Post(server.URL+"/askllm", "application/json", bytes.NewBufferString(`{"metrics": "m"}`))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+})
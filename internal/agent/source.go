@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+// MetricsSource collects the metric series sent to the agent for a target.
+type MetricsSource interface {
+	// Metrics adds the series for the target of request to its metrics and
+	// ingress fields.
+	Metrics(ctx context.Context, request *agentv1.Request, options MetricsOptions) error
+}
+
+// MetricsOptions selects what a MetricsSource collects for a request.
+type MetricsOptions struct {
+	// Pods are the names of the target's pods.
+	Pods []string
+	// Ingress is the name of the ingress in front of the target, if any.
+	Ingress string
+	// IngressController selects the metrics of the ingress, IngressNginx when empty.
+	IngressController string
+	// Queries are run after the built-in queries. Only Prometheus supports them.
+	Queries []Query
+	// Disabled holds the names of built-in queries to skip.
+	Disabled map[string]bool
+	// Window is the time range of the queries. Zero fields take their value
+	// from DefaultWindow. Sources without history ignore it.
+	Window Window
+	// RateWindow is the range of rate() in the queries, DefaultRateWindow when zero.
+	RateWindow time.Duration
+	// MultiResolution adds summarized views of every query over ContextWindows.
+	MultiResolution bool
+}
+
+// StaticFile reads metrics from a JSON file holding the metrics and ingress
+// fields of a request document. It is meant for tests and demos, so the same
+// metrics are returned for every target.
+type StaticFile struct {
+	Path string
+}
+
+func (f *StaticFile) Metrics(ctx context.Context, request *agentv1.Request, options MetricsOptions) error {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return fmt.Errorf("error reading metrics file: %v", err)
+	}
+	var file struct {
+		Metrics []agentv1.Metric `json:"metrics"`
+		Ingress *agentv1.Ingress `json:"ingress"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("error unmarshalling metrics file: %v", err)
+	}
+	for _, metric := range file.Metrics {
+		if !options.Disabled[metric.Name] {
+			request.Metrics = append(request.Metrics, metric)
+		}
+	}
+	if ingress := file.Ingress; ingress != nil {
+		if options.Disabled[QueryIngressRequests] {
+			ingress.RequestRate = nil
+		}
+		if options.Disabled[QueryIngressErrorRatio] {
+			ingress.ErrorRatio = nil
+		}
+		if options.Disabled[QueryIngressDuration] {
+			ingress.Duration = nil
+		}
+		if ingress.RequestRate != nil || ingress.ErrorRatio != nil || ingress.Duration != nil {
+			request.Ingress = ingress
+		}
+	}
+	return nil
+}
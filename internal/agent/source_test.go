@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+var _ = Describe("Metrics sources", func() {
+	ctx := context.Background()
+	target := agentv1.Target{Kind: "Deployment", Name: "app", Namespace: "default"}
+
+	It("should read metrics from a static file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "metrics.json")
+		Expect(os.WriteFile(path, []byte(`{
+			"metrics": [
+				{"name": "cpu_usage", "series": [{"labels": {"container": "app"}, "samples": [{"timestamp": 1700000000, "value": 0.5}]}]},
+				{"name": "node_available_memory", "series": []}
+			],
+			"ingress": {"name": "web", "requestRate": []}
+		}`), 0o600)).To(Succeed())
+
+		request := agentv1.NewRequest(target)
+		source := &StaticFile{Path: path}
+		Expect(source.Metrics(ctx, request, MetricsOptions{Disabled: map[string]bool{QueryNodeAvailableMemory: true}})).To(Succeed())
+		Expect(request.Metrics).To(HaveLen(1))
+		Expect(request.Metrics[0].Series[0].Samples[0].Value).To(Equal(0.5))
+		Expect(request.Ingress.Name).To(Equal("web"))
+	})
+
+	It("should read pod usage from the metrics API", func() {
+		podMetrics := func(name string, cpu string, memory string) *unstructured.Unstructured {
+			object := &unstructured.Unstructured{Object: map[string]interface{}{
+				"timestamp": "2024-11-01T10:00:00Z",
+				"containers": []interface{}{
+					map[string]interface{}{"name": "app", "usage": map[string]interface{}{"cpu": cpu, "memory": memory}},
+				},
+			}}
+			object.SetGroupVersionKind(schema.GroupVersionKind{Group: "metrics.k8s.io", Version: "v1beta1", Kind: "PodMetrics"})
+			object.SetName(name)
+			object.SetNamespace("default")
+			return object
+		}
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(schema.GroupVersionKind{Group: "metrics.k8s.io", Version: "v1beta1", Kind: "PodMetrics"}, meta.RESTScopeNamespace)
+		reader := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithRESTMapper(mapper).WithObjects(
+			podMetrics("app-1", "250m", "128Mi"),
+			podMetrics("other-1", "1", "1Gi"),
+		).Build()
+
+		request := agentv1.NewRequest(target)
+		source := &MetricsServer{Reader: reader}
+		Expect(source.Metrics(ctx, request, MetricsOptions{Pods: []string{"app-1"}})).To(Succeed())
+		Expect(request.Metrics).To(HaveLen(2))
+		Expect(request.Metrics[0].Name).To(Equal(QueryCPUUsage))
+		Expect(request.Metrics[0].Series).To(Equal([]agentv1.Series{{
+			Labels:  map[string]string{"pod": "app-1", "container": "app"},
+			Samples: []agentv1.Sample{{Timestamp: 1730455200, Value: 0.25}},
+		}}))
+		Expect(request.Metrics[1].Series[0].Samples[0].Value).To(Equal(float64(128 << 20)))
+
+		err := source.Metrics(ctx, request, MetricsOptions{Queries: []Query{{Name: "lag", Template: "kafka_lag"}}})
+		Expect(err).To(MatchError(ContainSubstring("custom queries need a Prometheus metrics source")))
+	})
+})
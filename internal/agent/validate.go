@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ValidateConfig checks that a recommendation is well formed: a positive
+// replica count and, for the top-level defaults and every container entry,
+// parsable CPU and memory quantities whose requests do not exceed their
+// limits. The top-level resource fields may only be left empty when
+// per-container recommendations are given.
+func ValidateConfig(config Config) error {
+	if config.Replicas < 1 {
+		return fmt.Errorf("replicas must be at least 1, got %d", config.Replicas)
+	}
+	defaults := config.ForContainer("")
+	if len(config.Containers) == 0 || !defaults.IsEmpty() {
+		if err := ValidateContainerConfig(defaults); err != nil {
+			return err
+		}
+	}
+	for name, container := range config.Containers {
+		if err := ValidateContainerConfig(container); err != nil {
+			return fmt.Errorf("container %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// ValidateContainerConfig checks the resource recommendation for a single container.
+func ValidateContainerConfig(config ContainerConfig) error {
+	cpuRequest, err := parseField("cpu_request", config.CPURequest)
+	if err != nil {
+		return err
+	}
+	cpuLimit, err := parseField("cpu_limit", config.CPULimit)
+	if err != nil {
+		return err
+	}
+	memoryRequest, err := parseField("memory_request", config.MemoryRequest)
+	if err != nil {
+		return err
+	}
+	memoryLimit, err := parseField("memory_limit", config.MemoryLimit)
+	if err != nil {
+		return err
+	}
+	if cpuRequest.Cmp(cpuLimit) > 0 {
+		return fmt.Errorf("cpu_request %s is greater than cpu_limit %s", config.CPURequest, config.CPULimit)
+	}
+	if memoryRequest.Cmp(memoryLimit) > 0 {
+		return fmt.Errorf("memory_request %s is greater than memory_limit %s", config.MemoryRequest, config.MemoryLimit)
+	}
+	return nil
+}
+
+func parseField(name string, value string) (resource.Quantity, error) {
+	if value == "" {
+		return resource.Quantity{}, fmt.Errorf("%s is empty", name)
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return resource.Quantity{}, fmt.Errorf("error parsing %s %q: %v", name, value, err)
+	}
+	if quantity.Sign() <= 0 {
+		return resource.Quantity{}, fmt.Errorf("%s must be positive, got %s", name, value)
+	}
+	return quantity, nil
+}
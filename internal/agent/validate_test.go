@@ -0,0 +1,42 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ValidateConfig", func() {
+	valid := Config{Replicas: 2, CPURequest: "100m", CPULimit: "200m", MemoryRequest: "128Mi", MemoryLimit: "256Mi"}
+
+	It("should accept a well formed recommendation", func() {
+		Expect(ValidateConfig(valid)).To(Succeed())
+	})
+
+	DescribeTable("should reject malformed recommendations",
+		func(mutate func(*Config), message string) {
+			config := valid
+			mutate(&config)
+			Expect(ValidateConfig(config)).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("zero replicas", func(c *Config) { c.Replicas = 0 }, "replicas"),
+		Entry("negative replicas", func(c *Config) { c.Replicas = -1 }, "replicas"),
+		Entry("empty field", func(c *Config) { c.MemoryLimit = "" }, "memory_limit is empty"),
+		Entry("unparsable quantity", func(c *Config) { c.CPULimit = "two cores" }, "error parsing cpu_limit"),
+		Entry("request above limit", func(c *Config) { c.MemoryRequest = "1Gi" }, "greater than memory_limit"),
+	)
+
+	It("should accept per-container recommendations without defaults", func() {
+		config := Config{Replicas: 2, Containers: map[string]ContainerConfig{
+			"app": {CPURequest: "100m", CPULimit: "200m", MemoryRequest: "128Mi", MemoryLimit: "256Mi"},
+		}}
+		Expect(ValidateConfig(config)).To(Succeed())
+	})
+
+	It("should name the container with a malformed recommendation", func() {
+		config := valid
+		config.Containers = map[string]ContainerConfig{
+			"sidecar": {CPURequest: "100m", CPULimit: "200m", MemoryRequest: "1Gi", MemoryLimit: "256Mi"},
+		}
+		Expect(ValidateConfig(config)).To(MatchError(ContainSubstring("container sidecar: memory_request")))
+	})
+})
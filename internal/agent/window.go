@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+// Window is the time range and resolution of a range query.
+type Window struct {
+	Range time.Duration
+	Step  time.Duration
+	// Offset moves the window into the past, e.g. by a week for last week's values.
+	Offset time.Duration
+}
+
+// DefaultWindow is used for the fields of MetricsOptions.Window left at zero.
+var DefaultWindow = Window{Range: 5 * time.Minute, Step: time.Minute}
+
+// DefaultRateWindow is the range of rate() when MetricsOptions.RateWindow is zero.
+const DefaultRateWindow = 2 * time.Minute
+
+// ContextWindows are the coarser views of every query added with
+// MetricsOptions.MultiResolution: the last 15 minutes, the last day and the
+// same hour one week ago.
+var ContextWindows = []Window{
+	{Range: 15 * time.Minute, Step: 30 * time.Second},
+	{Range: 24 * time.Hour, Step: 15 * time.Minute},
+	{Range: time.Hour, Step: 5 * time.Minute, Offset: 7 * 24 * time.Hour},
+}
+
+// maxContextSamples bounds the samples kept per series of a context window.
+// Longer series are averaged down to this many samples.
+const maxContextSamples = 32
+
+// withDefaults fills the zero fields of w from DefaultWindow.
+func (w Window) withDefaults() Window {
+	if w.Range <= 0 {
+		w.Range = DefaultWindow.Range
+	}
+	if w.Step <= 0 {
+		w.Step = DefaultWindow.Step
+	}
+	return w
+}
+
+// wire returns the window as sent to the agent.
+func (w Window) wire() *agentv1.Window {
+	window := &agentv1.Window{Range: promDuration(w.Range), Step: promDuration(w.Step)}
+	if w.Offset > 0 {
+		window.Offset = promDuration(w.Offset)
+	}
+	return window
+}
+
+// promDuration formats d in the largest whole Prometheus unit, e.g. 15m or 7d.
+func promDuration(d time.Duration) string {
+	for _, unit := range []struct {
+		suffix string
+		length time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	} {
+		if d >= unit.length && d%unit.length == 0 {
+			return fmt.Sprintf("%d%s", d/unit.length, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// summarize condenses the series of a context window: each series gets a
+// summary of all its samples and keeps at most maxContextSamples of them.
+func summarize(series []agentv1.Series) {
+	for i := range series {
+		samples := series[i].Samples
+		if len(samples) == 0 {
+			continue
+		}
+		summary := &agentv1.Summary{Min: math.Inf(1), Max: math.Inf(-1), Last: samples[len(samples)-1].Value, Count: len(samples)}
+		var sum float64
+		for _, sample := range samples {
+			summary.Min = math.Min(summary.Min, sample.Value)
+			summary.Max = math.Max(summary.Max, sample.Value)
+			sum += sample.Value
+		}
+		summary.Mean = sum / float64(len(samples))
+		series[i].Summary = summary
+		series[i].Samples = downsample(samples, maxContextSamples)
+	}
+}
+
+// downsample averages consecutive samples into at most limit samples, each
+// stamped with the time of the last sample it covers.
+func downsample(samples []agentv1.Sample, limit int) []agentv1.Sample {
+	if len(samples) <= limit {
+		return samples
+	}
+	downsampled := make([]agentv1.Sample, 0, limit)
+	for bucket := 0; bucket < limit; bucket++ {
+		start := bucket * len(samples) / limit
+		end := (bucket + 1) * len(samples) / limit
+		var sum float64
+		for _, sample := range samples[start:end] {
+			sum += sample.Value
+		}
+		downsampled = append(downsampled, agentv1.Sample{
+			Timestamp: samples[end-1].Timestamp,
+			Value:     sum / float64(end-start),
+		})
+	}
+	return downsampled
+}
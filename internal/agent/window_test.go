@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+)
+
+var _ = Describe("Windows", func() {
+	It("should format durations in Prometheus notation", func() {
+		Expect(promDuration(90 * time.Second)).To(Equal("90s"))
+		Expect(promDuration(15 * time.Minute)).To(Equal("15m"))
+		Expect(promDuration(7 * 24 * time.Hour)).To(Equal("7d"))
+		Expect(promDuration(1500 * time.Millisecond)).To(Equal("1500ms"))
+	})
+
+	It("should summarize series and bound their samples", func() {
+		var samples []agentv1.Sample
+		for i := 0; i < 96; i++ {
+			samples = append(samples, agentv1.Sample{Timestamp: float64(i * 900), Value: float64(i)})
+		}
+		series := []agentv1.Series{{Samples: samples}, {Samples: []agentv1.Sample{}}}
+		summarize(series)
+		Expect(series[0].Summary).To(Equal(&agentv1.Summary{Min: 0, Max: 95, Mean: 47.5, Last: 95, Count: 96}))
+		Expect(series[0].Samples).To(HaveLen(maxContextSamples))
+		Expect(series[0].Samples[0]).To(Equal(agentv1.Sample{Timestamp: 1800, Value: 1}))
+		Expect(series[0].Samples[maxContextSamples-1]).To(Equal(agentv1.Sample{Timestamp: 95 * 900, Value: 94}))
+		Expect(series[1].Summary).To(BeNil())
+	})
+})
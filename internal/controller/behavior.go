@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+// stabilizeReplicas applies the group's stabilization window and cooldowns
+// to a replica recommendation. It records the recommendation in the group's
+// window and returns the replica count to use, with a note explaining any
+// adjustment.
+func stabilizeReplicas(ipagroup ipav1alpha1.IPAGroup, groupStatus *ipav1alpha1.IPAGroupStatus, current int32, recommended int32, now time.Time) (int32, string) {
+	behavior := ipav1alpha1.ScalingBehavior{}
+	if ipagroup.Behavior != nil {
+		behavior = *ipagroup.Behavior
+	}
+
+	window := durationOf(behavior.StabilizationWindow)
+	recent := groupStatus.RecentReplicas[:0]
+	for _, entry := range groupStatus.RecentReplicas {
+		if now.Sub(entry.Time.Time) < window {
+			recent = append(recent, entry)
+		}
+	}
+	if window > 0 {
+		recent = append(recent, ipav1alpha1.TimedReplicas{Replicas: recommended, Time: metav1.NewTime(now)})
+	}
+	groupStatus.RecentReplicas = recent
+
+	replicas := recommended
+	var note string
+	if replicas < current {
+		for _, entry := range recent {
+			replicas = max(replicas, entry.Replicas)
+		}
+		replicas = min(replicas, current)
+		if replicas != recommended {
+			note = fmt.Sprintf("scale down to %d held at %d by stabilization window", recommended, replicas)
+		}
+	}
+
+	switch {
+	case replicas > current && within(groupStatus.LastScaleUpTime, durationOf(behavior.ScaleUpCooldown), now):
+		note = fmt.Sprintf("scale up to %d held by scale-up cooldown", replicas)
+		replicas = current
+	case replicas < current && (within(groupStatus.LastScaleDownTime, durationOf(behavior.ScaleDownCooldown), now) ||
+		within(groupStatus.LastScaleUpTime, durationOf(behavior.ScaleDownCooldown), now)):
+		note = fmt.Sprintf("scale down to %d held by scale-down cooldown", replicas)
+		replicas = current
+	}
+	return replicas, note
+}
+
+// recordScale stamps the group's last scale up or scale down time.
+func recordScale(groupStatus *ipav1alpha1.IPAGroupStatus, current int32, replicas int32, now time.Time) {
+	stamp := metav1.NewTime(now)
+	switch {
+	case replicas > current:
+		groupStatus.LastScaleUpTime = &stamp
+	case replicas < current:
+		groupStatus.LastScaleDownTime = &stamp
+	}
+}
+
+// within reports whether t is less than d before now.
+func within(t *metav1.Time, d time.Duration, now time.Time) bool {
+	return t != nil && d > 0 && now.Sub(t.Time) < d
+}
+
+func durationOf(d *metav1.Duration) time.Duration {
+	if d == nil {
+		return 0
+	}
+	return d.Duration
+}
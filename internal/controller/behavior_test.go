@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+var _ = Describe("Behavior", func() {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ipagroup := ipav1alpha1.IPAGroup{
+		Deployment: "app",
+		Namespace:  "default",
+		Behavior: &ipav1alpha1.ScalingBehavior{
+			ScaleUpCooldown:     &metav1.Duration{Duration: 3 * time.Minute},
+			ScaleDownCooldown:   &metav1.Duration{Duration: 5 * time.Minute},
+			StabilizationWindow: &metav1.Duration{Duration: 5 * time.Minute},
+		},
+	}
+
+	It("should scale down to the highest recommendation inside the window", func() {
+		groupStatus := &ipav1alpha1.IPAGroupStatus{RecentReplicas: []ipav1alpha1.TimedReplicas{
+			{Replicas: 9, Time: metav1.NewTime(now.Add(-10 * time.Minute))},
+			{Replicas: 6, Time: metav1.NewTime(now.Add(-2 * time.Minute))},
+		}}
+		replicas, note := stabilizeReplicas(ipagroup, groupStatus, 8, 3, now)
+		Expect(replicas).To(Equal(int32(6)))
+		Expect(note).To(ContainSubstring("stabilization window"))
+		Expect(groupStatus.RecentReplicas).To(HaveLen(2))
+	})
+
+	It("should hold a scale up during the scale-up cooldown", func() {
+		lastScaleUp := metav1.NewTime(now.Add(-time.Minute))
+		groupStatus := &ipav1alpha1.IPAGroupStatus{LastScaleUpTime: &lastScaleUp}
+		replicas, note := stabilizeReplicas(ipagroup, groupStatus, 4, 6, now)
+		Expect(replicas).To(Equal(int32(4)))
+		Expect(note).To(ContainSubstring("scale-up cooldown"))
+	})
+
+	It("should hold a scale down shortly after a scale up", func() {
+		lastScaleUp := metav1.NewTime(now.Add(-4 * time.Minute))
+		groupStatus := &ipav1alpha1.IPAGroupStatus{LastScaleUpTime: &lastScaleUp}
+		replicas, _ := stabilizeReplicas(ipagroup, groupStatus, 4, 2, now)
+		Expect(replicas).To(Equal(int32(4)))
+	})
+
+	It("should pass recommendations through once cooldowns have expired", func() {
+		lastScaleDown := metav1.NewTime(now.Add(-time.Hour))
+		groupStatus := &ipav1alpha1.IPAGroupStatus{LastScaleDownTime: &lastScaleDown}
+		replicas, note := stabilizeReplicas(ipagroup, groupStatus, 4, 7, now)
+		Expect(replicas).To(Equal(int32(7)))
+		Expect(note).To(BeEmpty())
+	})
+})
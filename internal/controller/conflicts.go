@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+// vpaListKind is the list kind of the VerticalPodAutoscaler CRD.
+var vpaListKind = schema.GroupVersionKind{Group: "autoscaling.k8s.io", Version: "v1", Kind: "VerticalPodAutoscalerList"}
+
+// passiveVPAModes are the VPA update modes that never change running pods.
+// Any other mode, including an unset one which defaults to Auto, competes with IPA.
+var passiveVPAModes = map[string]bool{
+	"Off":     true,
+	"Initial": true,
+}
+
+// conflictsFor returns the objects other than the IPA that also manage the
+// workload: other IPAs that are not in Recommend mode, HorizontalPodAutoscalers
+// and VerticalPodAutoscalers that update pods. Clusters without the VPA CRD
+// are not checked for VPAs.
+func (r *IPAReconciler) conflictsFor(ctx context.Context, ipa *ipav1alpha1.IPA, namespace string, ref autoscalingv2.CrossVersionObjectReference) ([]string, error) {
+	var conflicts []string
+
+	ipaList := &ipav1alpha1.IPAList{}
+	if err := r.List(ctx, ipaList, client.MatchingFields{ipaTargetIndex: targetKey(ref.Kind, namespace, ref.Name)}); err != nil {
+		return nil, fmt.Errorf("error listing IPAs: %v", err)
+	}
+	for _, other := range ipaList.Items {
+		if other.Spec.Mode == ipav1alpha1.ModeRecommend {
+			continue
+		}
+		if other.Namespace != ipa.Namespace || other.Name != ipa.Name {
+			conflicts = append(conflicts, fmt.Sprintf("IPA %s/%s", other.Namespace, other.Name))
+		}
+	}
+
+	hpaList := &autoscalingv2.HorizontalPodAutoscalerList{}
+	if err := r.List(ctx, hpaList, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("error listing HorizontalPodAutoscalers: %v", err)
+	}
+	for _, hpa := range hpaList.Items {
+		if sameTarget(hpa.Spec.ScaleTargetRef, ref) {
+			conflicts = append(conflicts, fmt.Sprintf("HorizontalPodAutoscaler %s/%s", hpa.Namespace, hpa.Name))
+		}
+	}
+
+	vpaList := &unstructured.UnstructuredList{}
+	vpaList.SetGroupVersionKind(vpaListKind)
+	err := r.List(ctx, vpaList, client.InNamespace(namespace))
+	if meta.IsNoMatchError(err) {
+		return conflicts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing VerticalPodAutoscalers: %v", err)
+	}
+	for _, vpa := range vpaList.Items {
+		var targetRef autoscalingv2.CrossVersionObjectReference
+		targetRef.APIVersion, _, _ = unstructured.NestedString(vpa.Object, "spec", "targetRef", "apiVersion")
+		targetRef.Kind, _, _ = unstructured.NestedString(vpa.Object, "spec", "targetRef", "kind")
+		targetRef.Name, _, _ = unstructured.NestedString(vpa.Object, "spec", "targetRef", "name")
+		updateMode, _, _ := unstructured.NestedString(vpa.Object, "spec", "updatePolicy", "updateMode")
+		if sameTarget(targetRef, ref) && !passiveVPAModes[updateMode] {
+			conflicts = append(conflicts, fmt.Sprintf("VerticalPodAutoscaler %s/%s", vpa.GetNamespace(), vpa.GetName()))
+		}
+	}
+	return conflicts, nil
+}
+
+// sameTarget reports whether two references point to the same workload. The
+// API group is only compared when both references set one, since HPA and VPA
+// references often omit it.
+func sameTarget(a autoscalingv2.CrossVersionObjectReference, b autoscalingv2.CrossVersionObjectReference) bool {
+	if a.Kind != b.Kind || a.Name != b.Name {
+		return false
+	}
+	if a.APIVersion == "" || b.APIVersion == "" {
+		return true
+	}
+	groupA, errA := schema.ParseGroupVersion(a.APIVersion)
+	groupB, errB := schema.ParseGroupVersion(b.APIVersion)
+	return errA != nil || errB != nil || groupA.Group == groupB.Group
+}
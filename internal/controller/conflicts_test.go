@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	controller "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+var _ = Describe("Conflicts", func() {
+	ctx := context.Background()
+	scheme := newScheme()
+
+	ref := autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app"}
+	ipa := &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	ipa.Spec.Metadata.IPAGroup = []ipav1alpha1.IPAGroup{{Deployment: "app", Namespace: "default"}}
+	hpa := func(name string, target string) *autoscalingv2.HorizontalPodAutoscaler {
+		return &autoscalingv2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+				ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: target},
+				MaxReplicas:    4,
+			},
+		}
+	}
+	vpa := func(name string, updateMode string) *unstructured.Unstructured {
+		object := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"targetRef": map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "app"},
+			},
+		}}
+		if updateMode != "" {
+			Expect(unstructured.SetNestedField(object.Object, updateMode, "spec", "updatePolicy", "updateMode")).To(Succeed())
+		}
+		object.SetGroupVersionKind(schema.GroupVersionKind{Group: "autoscaling.k8s.io", Version: "v1", Kind: "VerticalPodAutoscaler"})
+		object.SetName(name)
+		object.SetNamespace("default")
+		return object
+	}
+
+	It("should report other IPAs and HPAs managing the workload", func() {
+		other := &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{Name: "batch", Namespace: "default"}}
+		other.Spec.Metadata.IPAGroup = []ipav1alpha1.IPAGroup{{Deployment: "app", Namespace: "default"}}
+		reconciler := &IPAReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithIndex(&ipav1alpha1.IPA{}, ipaTargetIndex, ipaTargets).
+			WithObjects(ipa, other, hpa("app", "app"), hpa("worker", "worker")).Build()}
+
+		conflicts, err := reconciler.conflictsFor(ctx, ipa, "default", ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conflicts).To(ConsistOf("IPA default/batch", "HorizontalPodAutoscaler default/app"))
+	})
+
+	It("should not count IPAs in Recommend mode as competitors", func() {
+		observer := &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{Name: "observer", Namespace: "default"}}
+		observer.Spec.Mode = ipav1alpha1.ModeRecommend
+		observer.Spec.Metadata.IPAGroup = []ipav1alpha1.IPAGroup{{Deployment: "app", Namespace: "default"}}
+		reconciler := &IPAReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithIndex(&ipav1alpha1.IPA{}, ipaTargetIndex, ipaTargets).
+			WithObjects(ipa, observer).Build()}
+
+		conflicts, err := reconciler.conflictsFor(ctx, ipa, "default", ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conflicts).To(BeEmpty())
+		conflicts, err = reconciler.conflictsFor(ctx, observer, "default", ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conflicts).To(ConsistOf("IPA default/web"))
+	})
+
+	It("should only report VPAs that update pods", func() {
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(schema.GroupVersionKind{Group: "autoscaling.k8s.io", Version: "v1", Kind: "VerticalPodAutoscaler"}, meta.RESTScopeNamespace)
+		reconciler := &IPAReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).
+			WithIndex(&ipav1alpha1.IPA{}, ipaTargetIndex, ipaTargets).
+			WithObjects(ipa, vpa("auto", "Auto"), vpa("default-mode", ""), vpa("off", "Off"), vpa("initial", "Initial")).Build()}
+
+		conflicts, err := reconciler.conflictsFor(ctx, ipa, "default", ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conflicts).To(ConsistOf("VerticalPodAutoscaler default/auto", "VerticalPodAutoscaler default/default-mode"))
+	})
+
+	It("should still recommend for conflicting groups in Recommend mode", func() {
+		replicas := int32(2)
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "app"}},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+				},
+			},
+		}
+		recorder := record.NewFakeRecorder(10)
+		reconciler := &IPAReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).
+				WithIndex(&ipav1alpha1.IPA{}, ipaTargetIndex, ipaTargets).
+				WithObjects(ipa, deployment, hpa("app", "app")).
+				WithInterceptorFuncs(interceptor.Funcs{SubResourceGet: func(_ context.Context, _ client.Client, _ string, _ client.Object, subResource client.Object, _ ...client.SubResourceGetOption) error {
+					scale := subResource.(*unstructured.Unstructured)
+					scale.Object["spec"] = map[string]interface{}{"replicas": int64(replicas)}
+					scale.Object["status"] = map[string]interface{}{"selector": "app=app"}
+					return nil
+				}}).Build(),
+			Recorder: recorder,
+		}
+		recommending := ipa.DeepCopy()
+		recommending.Spec.Mode = ipav1alpha1.ModeRecommend
+		groupStatus := &ipav1alpha1.IPAGroupStatus{}
+		outcome := reconciler.reconcileGroup(ctx, recommending, noMetrics{}, fixedRecommender{replicas: 3},
+			recommending.Spec.Metadata.IPAGroup[0], groupStatus)
+		Expect(outcome.err).NotTo(HaveOccurred())
+		Expect(outcome.conflict).To(Equal("the workload is also managed by HorizontalPodAutoscaler default/app"))
+		Expect(groupStatus.Recommendation.Replicas).To(Equal(int32(3)))
+		Expect(recorder.Events).To(Receive(ContainSubstring("Conflict")))
+
+		groupStatus = &ipav1alpha1.IPAGroupStatus{}
+		outcome = reconciler.reconcileGroup(ctx, ipa, noMetrics{}, fixedRecommender{replicas: 3}, ipa.Spec.Metadata.IPAGroup[0], groupStatus)
+		Expect(outcome.conflict).To(HavePrefix("not evaluated"))
+		Expect(groupStatus.Recommendation).To(BeNil())
+	})
+
+	It("should match references with and without an API group", func() {
+		Expect(sameTarget(ref, autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: "app"})).To(BeTrue())
+		Expect(sameTarget(ref, autoscalingv2.CrossVersionObjectReference{APIVersion: "argoproj.io/v1alpha1", Kind: "Deployment", Name: "app"})).To(BeFalse())
+		Expect(sameTarget(ref, autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "app"})).To(BeFalse())
+	})
+})
+
+// noMetrics is a MetricsSource that adds nothing to the request.
+type noMetrics struct{}
+
+func (noMetrics) Metrics(context.Context, *agentv1.Request, controller.MetricsOptions) error {
+	return nil
+}
+
+// fixedRecommender always recommends the same replica count.
+type fixedRecommender struct {
+	replicas int32
+}
+
+func (f fixedRecommender) Recommend(context.Context, *agentv1.Request) (controller.LLMResponse, error) {
+	return controller.LLMResponse{Config: controller.Config{Replicas: f.replicas}}, nil
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	controller "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+// ipaSecretIndex indexes IPAs by the names of the Secrets their endpoint
+// credentials reference. Secrets are always in the IPA's namespace.
+const ipaSecretIndex = ".spec.metadata.secrets"
+
+// ipaSecrets returns the names of the Secrets referenced by the IPA.
+func ipaSecrets(obj client.Object) []string {
+	ipa := obj.(*ipav1alpha1.IPA)
+	var names []string
+	for _, auth := range []*ipav1alpha1.EndpointAuth{ipa.Spec.Metadata.PrometheusAuth, ipa.Spec.Metadata.LLMAgentAuth} {
+		for _, selector := range secretSelectors(auth) {
+			names = append(names, selector.Name)
+		}
+	}
+	return names
+}
+
+// secretSelectors returns every Secret key referenced by auth.
+func secretSelectors(auth *ipav1alpha1.EndpointAuth) []*corev1.SecretKeySelector {
+	if auth == nil {
+		return nil
+	}
+	selectors := []*corev1.SecretKeySelector{auth.BearerToken}
+	if auth.BasicAuth != nil {
+		selectors = append(selectors, &auth.BasicAuth.Username, &auth.BasicAuth.Password)
+	}
+	for i := range auth.Headers {
+		selectors = append(selectors, &auth.Headers[i].ValueFrom)
+	}
+	if auth.TLS != nil {
+		selectors = append(selectors, auth.TLS.CA, auth.TLS.Cert, auth.TLS.Key)
+	}
+	referenced := selectors[:0]
+	for _, selector := range selectors {
+		if selector != nil {
+			referenced = append(referenced, selector)
+		}
+	}
+	return referenced
+}
+
+// httpClientFor returns an HTTP client that authenticates with the
+// credentials of auth, read from Secrets in the IPA's namespace.
+func (r *IPAReconciler) httpClientFor(ctx context.Context, ipa *ipav1alpha1.IPA, auth *ipav1alpha1.EndpointAuth) (*http.Client, error) {
+	resolved, err := r.resolveAuth(ctx, ipa.Namespace, auth)
+	if err != nil {
+		return nil, err
+	}
+	return controller.NewHTTPClient(resolved)
+}
+
+// recommenderFor returns the Recommender of the IPA, calling LLMAgent with
+// the client built from its llmAgentAuth. Provider API keys are never taken
+// from the controller's environment, since the IPA author picks the endpoint
+// they would be sent to.
+func recommenderFor(ipa *ipav1alpha1.IPA, agent *http.Client) (controller.Recommender, error) {
+	return controller.NewRecommender(string(ipa.Spec.Metadata.LLMProvider), ipa.Spec.Metadata.LLMAgent, ipa.Spec.Metadata.LLMModel, "", agent)
+}
+
+// resolveAuth reads the Secret values referenced by auth.
+func (r *IPAReconciler) resolveAuth(ctx context.Context, namespace string, auth *ipav1alpha1.EndpointAuth) (*controller.Auth, error) {
+	if auth == nil {
+		return nil, nil
+	}
+	resolved := &controller.Auth{}
+	var err error
+	read := func(selector *corev1.SecretKeySelector) string {
+		if selector == nil || err != nil {
+			return ""
+		}
+		var value []byte
+		value, err = r.secretValue(ctx, namespace, *selector)
+		return string(value)
+	}
+	resolved.BearerToken = read(auth.BearerToken)
+	if auth.BasicAuth != nil {
+		resolved.Username = read(&auth.BasicAuth.Username)
+		resolved.Password = read(&auth.BasicAuth.Password)
+	}
+	for i := range auth.Headers {
+		if resolved.Headers == nil {
+			resolved.Headers = map[string]string{}
+		}
+		resolved.Headers[auth.Headers[i].Name] = read(&auth.Headers[i].ValueFrom)
+	}
+	if auth.TLS != nil {
+		resolved.CA = []byte(read(auth.TLS.CA))
+		resolved.Cert = []byte(read(auth.TLS.Cert))
+		resolved.Key = []byte(read(auth.TLS.Key))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// secretValue returns the value of a Secret key, read from the API server
+// since Secrets are not cached. A missing Secret or key is an error unless
+// the selector is optional.
+func (r *IPAReconciler) secretValue(ctx context.Context, namespace string, selector corev1.SecretKeySelector) ([]byte, error) {
+	optional := selector.Optional != nil && *selector.Optional
+	secret := &corev1.Secret{}
+	err := r.apiReader().Get(ctx, types.NamespacedName{Name: selector.Name, Namespace: namespace}, secret)
+	if apierrors.IsNotFound(err) && optional {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting secret %s: %v", selector.Name, err)
+	}
+	value, ok := secret.Data[selector.Key]
+	if !ok && !optional {
+		return nil, fmt.Errorf("key %s not found in secret %s", selector.Key, selector.Name)
+	}
+	return value, nil
+}
+
+// ipasForSecret maps a Secret to the IPAs in its namespace that reference it.
+func (r *IPAReconciler) ipasForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	ipaList := &ipav1alpha1.IPAList{}
+	if err := r.List(ctx, ipaList, client.InNamespace(obj.GetNamespace()), client.MatchingFields{ipaSecretIndex: obj.GetName()}); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(ipaList.Items))
+	for _, ipa := range ipaList.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: ipa.Name, Namespace: ipa.Namespace}})
+	}
+	return requests
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+var _ = Describe("Credentials", func() {
+	ctx := context.Background()
+	scheme := newScheme()
+
+	selector := func(name string, key string) corev1.SecretKeySelector {
+		return corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "thanos", Namespace: "default"},
+		Data:       map[string][]byte{"username": []byte("ipa"), "password": []byte("secret"), "tenant": []byte("team-a")},
+	}
+	ipa := &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	ipa.Spec.Metadata.PrometheusAuth = &ipav1alpha1.EndpointAuth{
+		BasicAuth: &ipav1alpha1.BasicAuth{Username: selector("thanos", "username"), Password: selector("thanos", "password")},
+		Headers:   []ipav1alpha1.SecretHeader{{Name: "X-Scope-OrgID", ValueFrom: selector("thanos", "tenant")}},
+	}
+	gatewayToken := selector("gateway", "token")
+	ipa.Spec.Metadata.LLMAgentAuth = &ipav1alpha1.EndpointAuth{BearerToken: &gatewayToken}
+	var reconciler *IPAReconciler
+
+	BeforeEach(func() {
+		// Secrets are read through the APIReader, not the cached Client.
+		reconciler = &IPAReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).
+				WithIndex(&ipav1alpha1.IPA{}, ipaSecretIndex, ipaSecrets).
+				WithObjects(ipa).Build(),
+			APIReader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build(),
+		}
+	})
+
+	It("should read the referenced Secret keys", func() {
+		auth, err := reconciler.resolveAuth(ctx, "default", ipa.Spec.Metadata.PrometheusAuth)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth.Username).To(Equal("ipa"))
+		Expect(auth.Password).To(Equal("secret"))
+		Expect(auth.Headers).To(Equal(map[string]string{"X-Scope-OrgID": "team-a"}))
+
+		auth, err = reconciler.resolveAuth(ctx, "default", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth).To(BeNil())
+	})
+
+	It("should fail on missing Secrets and keys unless they are optional", func() {
+		_, err := reconciler.resolveAuth(ctx, "default", ipa.Spec.Metadata.LLMAgentAuth)
+		Expect(err).To(MatchError(ContainSubstring("error getting secret gateway")))
+
+		missingKey := selector("thanos", "token")
+		_, err = reconciler.resolveAuth(ctx, "default", &ipav1alpha1.EndpointAuth{BearerToken: &missingKey})
+		Expect(err).To(MatchError("key token not found in secret thanos"))
+
+		optional := true
+		token := selector("gateway", "token")
+		token.Optional = &optional
+		auth, err := reconciler.resolveAuth(ctx, "default", &ipav1alpha1.EndpointAuth{BearerToken: &token})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth.BearerToken).To(BeEmpty())
+	})
+
+	It("should map a Secret to the IPAs referencing it", func() {
+		Expect(ipaSecrets(ipa)).To(ConsistOf("thanos", "thanos", "thanos", "gateway"))
+		requests := reconciler.ipasForSecret(ctx, secret)
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Name).To(Equal("web"))
+		other := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "thanos", Namespace: "shop"}}
+		Expect(reconciler.ipasForSecret(ctx, other)).To(BeEmpty())
+	})
+
+	It("should only send provider keys from llmAgentAuth Secrets", func() {
+		for name, value := range map[string]string{"OPENAI_API_KEY": "operator-openai", "ANTHROPIC_API_KEY": "operator-anthropic"} {
+			Expect(os.Setenv(name, value)).To(Succeed())
+			DeferCleanup(os.Unsetenv, name)
+		}
+		var headers []http.Header
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers = append(headers, r.Header.Clone())
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"content": [{"type": "text", "text": "{\"replicas\": 2}"}], "choices": [{"message": {"content": "{\"replicas\": 2}"}}]}`))
+		}))
+		defer server.Close()
+
+		tenant := &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{Name: "tenant", Namespace: "default"}}
+		tenant.Spec.Metadata.LLMAgent = server.URL
+		request := agentv1.NewRequest(agentv1.Target{Kind: "Deployment", Name: "web", Namespace: "default"})
+		recommend := func() {
+			agent, err := reconciler.httpClientFor(ctx, tenant, tenant.Spec.Metadata.LLMAgentAuth)
+			Expect(err).NotTo(HaveOccurred())
+			recommender, err := recommenderFor(tenant, agent)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = recommender.Recommend(ctx, request)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		for _, provider := range []ipav1alpha1.LLMProvider{"OpenAI", "Anthropic"} {
+			tenant.Spec.Metadata.LLMProvider = provider
+			recommend()
+		}
+		Expect(headers).To(HaveLen(2))
+		for _, header := range headers {
+			Expect(header).NotTo(HaveKey("Authorization"))
+			Expect(header).NotTo(HaveKey("X-Api-Key"))
+		}
+
+		tenant.Spec.Metadata.LLMAgentAuth = &ipav1alpha1.EndpointAuth{
+			Headers: []ipav1alpha1.SecretHeader{{Name: "x-api-key", ValueFrom: selector("thanos", "password")}},
+		}
+		recommend()
+		Expect(headers[2].Get("x-api-key")).To(Equal("secret"))
+	})
+})
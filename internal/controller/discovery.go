@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+// selectorTarget returns the apiVersion and kind of the workloads a target
+// selector discovers, defaulting to apps/v1 Deployments.
+func selectorTarget(selector *ipav1alpha1.TargetSelector) (string, string) {
+	apiVersion, kind := selector.APIVersion, selector.Kind
+	if apiVersion == "" {
+		apiVersion = "apps/v1"
+	}
+	if kind == "" {
+		kind = "Deployment"
+	}
+	return apiVersion, kind
+}
+
+// expandGroups returns the groups of the IPA with every target selector
+// replaced by one group per matching workload. Workloads named explicitly take
+// precedence over discovered ones, and a workload matched by several selectors
+// is only evaluated once, with the settings of the first group. Selectors
+// whose workloads cannot be listed are skipped; their indices are returned
+// with a problem for each.
+func (r *IPAReconciler) expandGroups(ctx context.Context, ipa *ipav1alpha1.IPA) ([]ipav1alpha1.IPAGroup, []int, []string) {
+	var groups []ipav1alpha1.IPAGroup
+	seen := map[string]bool{}
+	for _, ipagroup := range ipa.Spec.Metadata.IPAGroup {
+		if ipagroup.TargetSelector == nil {
+			groups = append(groups, ipagroup)
+			seen[describeTarget(ipagroup.Namespace, scaleTargetRef(ipagroup))] = true
+		}
+	}
+	var failed []int
+	var problems []string
+	for i, ipagroup := range ipa.Spec.Metadata.IPAGroup {
+		if ipagroup.TargetSelector == nil {
+			continue
+		}
+		discovered, err := r.discoverTargets(ctx, ipagroup)
+		if err != nil {
+			failed = append(failed, i)
+			problems = append(problems, fmt.Sprintf("ipaGroup[%d]: %v", i, err))
+			continue
+		}
+		for _, group := range discovered {
+			key := describeTarget(group.Namespace, scaleTargetRef(group))
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			groups = append(groups, group)
+		}
+	}
+	return groups, failed, problems
+}
+
+// mayBeSelectedBy reports whether the status entry could belong to a
+// workload discovered by the group's target selector. Labels are not
+// checked, so the answer is only used to keep entries when discovery fails.
+func mayBeSelectedBy(groupStatus ipav1alpha1.IPAGroupStatus, ipagroup ipav1alpha1.IPAGroup) bool {
+	targetSelector := ipagroup.TargetSelector
+	if !groupStatus.Discovered || targetSelector == nil {
+		return false
+	}
+	apiVersion, kind := selectorTarget(targetSelector)
+	if groupStatus.ScaleTargetRef.APIVersion != apiVersion || groupStatus.ScaleTargetRef.Kind != kind {
+		return false
+	}
+	return targetSelector.NamespaceSelector != nil || groupStatus.Namespace == ipagroup.Namespace
+}
+
+// isDiscovered reports whether the group was expanded from a target selector
+// rather than named in the spec.
+func isDiscovered(ipa *ipav1alpha1.IPA, ipagroup ipav1alpha1.IPAGroup) bool {
+	for _, specGroup := range ipa.Spec.Metadata.IPAGroup {
+		if specGroup.TargetSelector == nil && specGroup.Namespace == ipagroup.Namespace && scaleTargetRef(specGroup) == scaleTargetRef(ipagroup) {
+			return false
+		}
+	}
+	return true
+}
+
+// discoverTargets lists the workloads matching the group's target selector
+// and returns a copy of the group for each of them.
+func (r *IPAReconciler) discoverTargets(ctx context.Context, ipagroup ipav1alpha1.IPAGroup) ([]ipav1alpha1.IPAGroup, error) {
+	targetSelector := ipagroup.TargetSelector
+	selector, err := metav1.LabelSelectorAsSelector(&targetSelector.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing selector: %v", err)
+	}
+	namespaces := []string{ipagroup.Namespace}
+	if targetSelector.NamespaceSelector != nil {
+		namespaces, err = r.selectNamespaces(ctx, targetSelector.NamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+	}
+	apiVersion, kind := selectorTarget(targetSelector)
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing apiVersion %q: %v", apiVersion, err)
+	}
+	var groups []ipav1alpha1.IPAGroup
+	for _, namespace := range namespaces {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gv.WithKind(kind + "List"))
+		err := r.List(ctx, list, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s in %s: %v", kind, namespace, err)
+		}
+		for _, item := range list.Items {
+			group := *ipagroup.DeepCopy()
+			group.TargetSelector = nil
+			group.Namespace = item.GetNamespace()
+			group.ScaleTargetRef = &autoscalingv2.CrossVersionObjectReference{APIVersion: apiVersion, Kind: kind, Name: item.GetName()}
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// selectNamespaces returns the names of the namespaces matching selector.
+func (r *IPAReconciler) selectNamespaces(ctx context.Context, namespaceSelector *metav1.LabelSelector) ([]string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(namespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing namespace selector: %v", err)
+	}
+	namespaceList := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaceList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("error listing namespaces: %v", err)
+	}
+	var namespaces []string
+	for _, namespace := range namespaceList.Items {
+		namespaces = append(namespaces, namespace.Name)
+	}
+	return namespaces, nil
+}
+
+// ipasSelecting maps a workload to the IPAs with a target selector that
+// matches it, so new or relabelled workloads are picked up without waiting
+// for the next evaluation.
+func (r *IPAReconciler) ipasSelecting(ctx context.Context, obj client.Object) []reconcile.Request {
+	gvk, err := r.GroupVersionKindFor(obj)
+	if err != nil {
+		return nil
+	}
+	ipaList := &ipav1alpha1.IPAList{}
+	if err := r.List(ctx, ipaList); err != nil {
+		return nil
+	}
+	var namespaceLabels labels.Set
+	var requests []reconcile.Request
+	for _, ipa := range ipaList.Items {
+		for _, ipagroup := range ipa.Spec.Metadata.IPAGroup {
+			targetSelector := ipagroup.TargetSelector
+			if targetSelector == nil {
+				continue
+			}
+			apiVersion, kind := selectorTarget(targetSelector)
+			if kind != gvk.Kind || apiVersion != gvk.GroupVersion().String() {
+				continue
+			}
+			selector, err := metav1.LabelSelectorAsSelector(&targetSelector.Selector)
+			if err != nil || !selector.Matches(labels.Set(obj.GetLabels())) {
+				continue
+			}
+			if targetSelector.NamespaceSelector == nil {
+				if ipagroup.Namespace != obj.GetNamespace() {
+					continue
+				}
+			} else {
+				if namespaceLabels == nil {
+					namespace := &corev1.Namespace{}
+					if err := r.Get(ctx, types.NamespacedName{Name: obj.GetNamespace()}, namespace); err != nil {
+						continue
+					}
+					namespaceLabels = labels.Set(namespace.Labels)
+				}
+				namespaceSelector, err := metav1.LabelSelectorAsSelector(targetSelector.NamespaceSelector)
+				if err != nil || !namespaceSelector.Matches(namespaceLabels) {
+					continue
+				}
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: ipa.Name, Namespace: ipa.Namespace}})
+			break
+		}
+	}
+	return requests
+}
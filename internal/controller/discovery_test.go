@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+var _ = Describe("Discovery", func() {
+	ctx := context.Background()
+	scheme := newScheme()
+
+	deployment := func(namespace string, name string, tier string) *appsv1.Deployment {
+		return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"tier": tier},
+		}}
+	}
+	namespace := func(name string, team string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"team": team}}}
+	}
+	selectorGroup := func() ipav1alpha1.IPAGroup {
+		minReplicas := int32(2)
+		return ipav1alpha1.IPAGroup{
+			TargetSelector: &ipav1alpha1.TargetSelector{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "web"}},
+				Selector:          metav1.LabelSelector{MatchLabels: map[string]string{"tier": "frontend"}},
+			},
+			MinReplicas: &minReplicas,
+		}
+	}
+	var reconciler *IPAReconciler
+
+	BeforeEach(func() {
+		reconciler = &IPAReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			namespace("shop", "web"),
+			namespace("blog", "web"),
+			namespace("batch", "data"),
+			deployment("shop", "cart", "frontend"),
+			deployment("shop", "worker", "backend"),
+			deployment("blog", "site", "frontend"),
+			deployment("batch", "ui", "frontend"),
+		).Build()}
+	})
+
+	It("should expand target selectors into one group per matching workload", func() {
+		ipa := &ipav1alpha1.IPA{}
+		ipa.Spec.Metadata.IPAGroup = []ipav1alpha1.IPAGroup{
+			selectorGroup(),
+			{Deployment: "cart", Namespace: "shop"},
+		}
+		groups, failed, problems := reconciler.expandGroups(ctx, ipa)
+		Expect(failed).To(BeEmpty())
+		Expect(problems).To(BeEmpty())
+		var targets []string
+		for _, group := range groups {
+			targets = append(targets, describeTarget(group.Namespace, scaleTargetRef(group)))
+		}
+		Expect(targets).To(ConsistOf("Deployment shop/cart", "Deployment blog/site"))
+		Expect(groups[0].MinReplicas).To(BeNil())
+		Expect(*groups[1].MinReplicas).To(Equal(int32(2)))
+		Expect(isDiscovered(ipa, groups[0])).To(BeFalse())
+		Expect(isDiscovered(ipa, groups[1])).To(BeTrue())
+	})
+
+	It("should report the selectors whose workloads cannot be listed", func() {
+		broken := selectorGroup()
+		broken.TargetSelector.APIVersion = "apps/v1/extra"
+		ipa := &ipav1alpha1.IPA{}
+		ipa.Spec.Metadata.IPAGroup = []ipav1alpha1.IPAGroup{{Deployment: "cart", Namespace: "shop"}, broken}
+		groups, failed, problems := reconciler.expandGroups(ctx, ipa)
+		Expect(groups).To(HaveLen(1))
+		Expect(failed).To(Equal([]int{1}))
+		Expect(problems).To(ConsistOf(ContainSubstring("ipaGroup[1]")))
+	})
+
+	It("should enqueue the IPAs whose selectors match a workload", func() {
+		ipa := &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{Name: "platform", Namespace: "default"}}
+		ipa.Spec.Metadata.IPAGroup = []ipav1alpha1.IPAGroup{selectorGroup()}
+		Expect(reconciler.Create(ctx, ipa)).To(Succeed())
+
+		requests := reconciler.ipasSelecting(ctx, deployment("blog", "new", "frontend"))
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Name).To(Equal("platform"))
+		Expect(reconciler.ipasSelecting(ctx, deployment("blog", "db", "backend"))).To(BeEmpty())
+		Expect(reconciler.ipasSelecting(ctx, deployment("batch", "ui", "frontend"))).To(BeEmpty())
+	})
+})
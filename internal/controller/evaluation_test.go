@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+var _ = Describe("Evaluation", func() {
+	ctx := context.Background()
+	scheme := newScheme()
+	// The fake client registers unknown unstructured list kinds in the scheme
+	// on first use, which races with parallel groups listing VPAs.
+	scheme.AddKnownTypeWithName(vpaListKind.GroupVersion().WithKind("VerticalPodAutoscaler"), &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(vpaListKind, &unstructured.UnstructuredList{})
+
+	deployment := func(name string) *appsv1.Deployment {
+		replicas := int32(2)
+		labels := map[string]string{"app": name}
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+						Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+					}}}},
+				},
+			},
+		}
+	}
+	newIPA := func(url string, deployments ...string) *ipav1alpha1.IPA {
+		ipa := &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+		ipa.Spec.Metadata.PrometheusUri = url
+		ipa.Spec.Metadata.LLMAgent = url
+		for _, name := range deployments {
+			ipa.Spec.Metadata.IPAGroup = append(ipa.Spec.Metadata.IPAGroup, ipav1alpha1.IPAGroup{Deployment: name, Namespace: "default"})
+		}
+		return ipa
+	}
+	// server serves empty Prometheus results and answers the agent protocol
+	// with recommend.
+	server := func(recommend func(ctx context.Context, request *agentv1.Request) agentv1.Config) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path != "/askllm" {
+				_, _ = w.Write([]byte(`{"status": "success", "data": {"resultType": "matrix", "result": []}}`))
+				return
+			}
+			request := &agentv1.Request{}
+			if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(agentv1.Response{Status: "success", Config: recommend(r.Context(), request)})
+		}))
+	}
+	// newReconciler returns a reconciler for a fake cluster holding objects.
+	// The fake client cannot serve the scale subresource of an unstructured
+	// workload, so it is read from the Deployment. Patches are only recorded.
+	var patchesLock sync.Mutex
+	var patches []string
+	newReconciler := func(objects ...client.Object) *IPAReconciler {
+		patches = nil
+		return &IPAReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).
+				WithIndex(&ipav1alpha1.IPA{}, ipaTargetIndex, ipaTargets).
+				WithObjects(objects...).
+				WithInterceptorFuncs(interceptor.Funcs{
+					SubResourceGet: func(ctx context.Context, c client.Client, _ string, obj client.Object, subResource client.Object, _ ...client.SubResourceGetOption) error {
+						deployment := &appsv1.Deployment{}
+						if err := c.Get(ctx, client.ObjectKeyFromObject(obj), deployment); err != nil {
+							return err
+						}
+						scale := subResource.(*unstructured.Unstructured)
+						scale.Object["spec"] = map[string]interface{}{"replicas": int64(*deployment.Spec.Replicas)}
+						scale.Object["status"] = map[string]interface{}{"selector": "app=" + deployment.Name}
+						return nil
+					},
+					Patch: func(_ context.Context, _ client.WithWatch, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+						patchesLock.Lock()
+						defer patchesLock.Unlock()
+						patches = append(patches, obj.GetName())
+						return nil
+					},
+				}).Build(),
+			Recorder: record.NewFakeRecorder(100),
+		}
+	}
+	request := ctrl.Request{NamespacedName: types.NamespacedName{Name: "web", Namespace: "default"}}
+
+	It("should record the proposal of a Recommend mode group without changing the workload", func() {
+		agent := server(func(context.Context, *agentv1.Request) agentv1.Config {
+			return agentv1.Config{Replicas: 4, CPURequest: "150m", CPULimit: "300m", MemoryRequest: "96Mi", MemoryLimit: "192Mi"}
+		})
+		defer agent.Close()
+		ipa := newIPA(agent.URL, "app")
+		ipa.Spec.Mode = ipav1alpha1.ModeRecommend
+		reconciler := newReconciler(ipa, deployment("app"))
+
+		_, err := reconciler.IPA(ctx, ipa, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ipa.Status.Groups).To(HaveLen(1))
+		group := ipa.Status.Groups[0]
+		Expect(group.Message).To(BeEmpty())
+		Expect(group.Recommendation.Replicas).To(Equal(int32(4)))
+		Expect(group.Recommendation.CPURequest).To(Equal("150m"))
+		Expect(group.Recommendation.MemoryLimit).To(Equal("192Mi"))
+		Expect(group.History).To(ConsistOf(And(HaveField("Applied", false), HaveField("Message", "IPA is in Recommend mode"))))
+		Expect(group.Original).To(BeNil())
+		Expect(group.LastAppliedTime).To(BeNil())
+		Expect(meta.FindStatusCondition(ipa.Status.Conditions, ipav1alpha1.ConditionApplied).Reason).To(Equal("RecommendOnly"))
+
+		Expect(patches).To(BeEmpty())
+		current := &appsv1.Deployment{}
+		Expect(reconciler.Get(ctx, types.NamespacedName{Name: "app", Namespace: "default"}, current)).To(Succeed())
+		Expect(*current.Spec.Replicas).To(Equal(int32(2)))
+		Expect(current.Annotations).NotTo(HaveKey(originalAnnotation))
+		Expect(current.Spec.Template.Spec.Containers[0].Resources).To(Equal(deployment("app").Spec.Template.Spec.Containers[0].Resources))
+	})
+
+	It("should raise a replica count of 0 to minReplicas instead of rejecting it", func() {
+		agent := server(func(context.Context, *agentv1.Request) agentv1.Config {
+			return agentv1.Config{Replicas: 0, CPURequest: "100m", CPULimit: "200m", MemoryRequest: "64Mi", MemoryLimit: "128Mi"}
+		})
+		defer agent.Close()
+		ipa := newIPA(agent.URL, "app", "unbounded")
+		ipa.Spec.Mode = ipav1alpha1.ModeRecommend
+		minReplicas := int32(3)
+		ipa.Spec.Metadata.IPAGroup[0].MinReplicas = &minReplicas
+		reconciler := newReconciler(ipa, deployment("app"), deployment("unbounded"))
+
+		_, err := reconciler.IPA(ctx, ipa, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ipa.Status.Groups).To(HaveLen(2))
+		group := ipa.Status.Groups[0]
+		Expect(group.Recommendation.Replicas).To(Equal(int32(3)))
+		Expect(group.Clamps).To(ConsistOf(And(HaveField("Field", "replicas"), HaveField("Recommended", "0"), HaveField("Applied", "3"))))
+		Expect(group.History).To(ConsistOf(HaveField("Message", "IPA is in Recommend mode")))
+
+		// Without a minimum there is nothing to clamp to, so 0 is rejected.
+		unbounded := ipa.Status.Groups[1]
+		Expect(unbounded.Recommendation.Replicas).To(BeZero())
+		Expect(unbounded.History).To(ConsistOf(HaveField("Message", "rejected: replicas must be at least 1, got 0")))
+	})
+
+	It("should bound parallel groups and fail only the groups that time out", func() {
+		var lock sync.Mutex
+		var inFlight, maxInFlight int
+		agent := server(func(ctx context.Context, request *agentv1.Request) agentv1.Config {
+			lock.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			lock.Unlock()
+			defer func() {
+				lock.Lock()
+				inFlight--
+				lock.Unlock()
+			}()
+			delay := 50 * time.Millisecond
+			if request.Target.Name == "slow" {
+				delay = 5 * time.Second
+			}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
+			return agentv1.Config{Replicas: 3, CPURequest: "100m", CPULimit: "200m", MemoryRequest: "64Mi", MemoryLimit: "128Mi"}
+		})
+		defer agent.Close()
+		names := []string{"a", "b", "slow", "c", "d"}
+		ipa := newIPA(agent.URL, names...)
+		ipa.Spec.Mode = ipav1alpha1.ModeRecommend
+		parallelism := int32(2)
+		ipa.Spec.Parallelism = &parallelism
+		ipa.Spec.GroupTimeout = &metav1.Duration{Duration: 300 * time.Millisecond}
+		objects := []client.Object{ipa}
+		for _, name := range names {
+			objects = append(objects, deployment(name))
+		}
+		reconciler := newReconciler(objects...)
+
+		_, err := reconciler.IPA(ctx, ipa, request)
+		Expect(err).NotTo(HaveOccurred())
+		lock.Lock()
+		Expect(maxInFlight).To(Equal(2))
+		lock.Unlock()
+		Expect(ipa.Status.Groups).To(HaveLen(len(names)))
+		for _, group := range ipa.Status.Groups {
+			if group.ScaleTargetRef.Name == "slow" {
+				Expect(group.Failures).To(Equal(int32(1)))
+				Expect(group.Message).To(ContainSubstring("context deadline exceeded"))
+				Expect(group.Recommendation).To(BeNil())
+				continue
+			}
+			Expect(group.Failures).To(BeZero(), group.ScaleTargetRef.Name)
+			Expect(group.Message).To(BeEmpty())
+			Expect(group.Recommendation.Replicas).To(Equal(int32(3)))
+		}
+		agentReachable := meta.FindStatusCondition(ipa.Status.Conditions, ipav1alpha1.ConditionAgentReachable)
+		Expect(agentReachable.Status).To(Equal(metav1.ConditionFalse))
+		Expect(agentReachable.Message).To(HavePrefix("Deployment default/slow: "))
+	})
+})
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	controller "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+// clampConfig pulls every field of the LLM recommendation into the bounds
+// configured on the IPA group and returns the adjusted config along with a
+// record of each value that had to be changed.
+func clampConfig(ipagroup ipav1alpha1.IPAGroup, config controller.Config) (controller.Config, []ipav1alpha1.Clamp, error) {
+	now := metav1.Now()
+	config, clamps := clampReplicas(ipagroup, config)
+
+	bounds := ipav1alpha1.ResourceBounds{}
+	if ipagroup.Resources != nil {
+		bounds = *ipagroup.Resources
+	}
+	defaults := config.ForContainer("")
+	if !defaults.IsEmpty() {
+		defaultClamps, err := clampContainerConfig(bounds, "", &defaults, now)
+		if err != nil {
+			return config, nil, err
+		}
+		clamps = append(clamps, defaultClamps...)
+		config.CPURequest, config.CPULimit = defaults.CPURequest, defaults.CPULimit
+		config.MemoryRequest, config.MemoryLimit = defaults.MemoryRequest, defaults.MemoryLimit
+	}
+	if len(config.Containers) > 0 {
+		containers := make(map[string]agentv1.ContainerConfig, len(config.Containers))
+		for name, container := range config.Containers {
+			containerClamps, err := clampContainerConfig(bounds, name, &container, now)
+			if err != nil {
+				return config, nil, err
+			}
+			clamps = append(clamps, containerClamps...)
+			containers[name] = container
+		}
+		config.Containers = containers
+	}
+	return config, clamps, nil
+}
+
+// clampReplicas pulls the recommended replica count into the group's bounds.
+// It runs before the recommendation is validated, so that a replica count
+// below the minimum, including 0, is raised to minReplicas instead of
+// rejecting the whole recommendation.
+func clampReplicas(ipagroup ipav1alpha1.IPAGroup, config controller.Config) (controller.Config, []ipav1alpha1.Clamp) {
+	replicas := config.Replicas
+	if ipagroup.MinReplicas != nil && replicas < *ipagroup.MinReplicas {
+		replicas = *ipagroup.MinReplicas
+	}
+	if ipagroup.MaxReplicas != nil && replicas > *ipagroup.MaxReplicas {
+		replicas = *ipagroup.MaxReplicas
+	}
+	if replicas == config.Replicas {
+		return config, nil
+	}
+	clamp := ipav1alpha1.Clamp{
+		Field:       "replicas",
+		Recommended: strconv.Itoa(int(config.Replicas)),
+		Applied:     strconv.Itoa(int(replicas)),
+		Time:        metav1.Now(),
+	}
+	config.Replicas = replicas
+	return config, []ipav1alpha1.Clamp{clamp}
+}
+
+// clampContainerConfig clamps the resource values of a single container
+// recommendation in place. A request clamped above its limit raises the
+// limit, or both settle on the limit's maximum when it cannot go that high.
+func clampContainerConfig(bounds ipav1alpha1.ResourceBounds, container string, config *agentv1.ContainerConfig, now metav1.Time) ([]ipav1alpha1.Clamp, error) {
+	fields := []struct {
+		name   string
+		value  *string
+		bounds *ipav1alpha1.QuantityBounds
+	}{
+		{"cpuRequest", &config.CPURequest, bounds.CPURequest},
+		{"cpuLimit", &config.CPULimit, bounds.CPULimit},
+		{"memoryRequest", &config.MemoryRequest, bounds.MemoryRequest},
+		{"memoryLimit", &config.MemoryLimit, bounds.MemoryLimit},
+	}
+	recommended := make([]resource.Quantity, len(fields))
+	clamped := make([]resource.Quantity, len(fields))
+	for i, field := range fields {
+		quantity, err := resource.ParseQuantity(*field.value)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s %q: %v", field.name, *field.value, err)
+		}
+		recommended[i] = quantity
+		clamped[i], _ = clampQuantity(quantity, field.bounds)
+	}
+	for _, pair := range [][2]int{{0, 1}, {2, 3}} {
+		request, limit := &clamped[pair[0]], &clamped[pair[1]]
+		if request.Cmp(*limit) <= 0 {
+			continue
+		}
+		limitBounds := fields[pair[1]].bounds
+		if limitBounds == nil || limitBounds.Max == nil || request.Cmp(*limitBounds.Max) <= 0 {
+			*limit = request.DeepCopy()
+			continue
+		}
+		if requestBounds := fields[pair[0]].bounds; requestBounds != nil && requestBounds.Min != nil && requestBounds.Min.Cmp(*limitBounds.Max) > 0 {
+			return nil, fmt.Errorf("%s min %s is greater than %s max %s",
+				fields[pair[0]].name, requestBounds.Min.String(), fields[pair[1]].name, limitBounds.Max.String())
+		}
+		*request = limitBounds.Max.DeepCopy()
+		*limit = limitBounds.Max.DeepCopy()
+	}
+	var clamps []ipav1alpha1.Clamp
+	for i, field := range fields {
+		if clamped[i].Cmp(recommended[i]) == 0 {
+			continue
+		}
+		clamps = append(clamps, ipav1alpha1.Clamp{
+			Field:       field.name,
+			Container:   container,
+			Recommended: *field.value,
+			Applied:     clamped[i].String(),
+			Time:        now,
+		})
+		*field.value = clamped[i].String()
+	}
+	return clamps, nil
+}
+
+// clampQuantity returns q limited to bounds and whether it had to be changed.
+func clampQuantity(q resource.Quantity, bounds *ipav1alpha1.QuantityBounds) (resource.Quantity, bool) {
+	if bounds == nil {
+		return q, false
+	}
+	if bounds.Min != nil && q.Cmp(*bounds.Min) < 0 {
+		return bounds.Min.DeepCopy(), true
+	}
+	if bounds.Max != nil && q.Cmp(*bounds.Max) > 0 {
+		return bounds.Max.DeepCopy(), true
+	}
+	return q, false
+}
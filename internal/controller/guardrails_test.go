@@ -0,0 +1,86 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	controller "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+var _ = Describe("Guardrails", func() {
+	minReplicas, maxReplicas := int32(2), int32(5)
+	memoryFloor := resource.MustParse("128Mi")
+	cpuCeiling := resource.MustParse("1")
+	ipagroup := ipav1alpha1.IPAGroup{
+		Deployment:  "app",
+		Namespace:   "default",
+		MinReplicas: &minReplicas,
+		MaxReplicas: &maxReplicas,
+		Resources: &ipav1alpha1.ResourceBounds{
+			MemoryLimit: &ipav1alpha1.QuantityBounds{Min: &memoryFloor},
+			CPULimit:    &ipav1alpha1.QuantityBounds{Max: &cpuCeiling},
+		},
+	}
+
+	It("should leave in-bounds recommendations untouched", func() {
+		config := controller.Config{Replicas: 3, CPURequest: "100m", CPULimit: "500m", MemoryRequest: "128Mi", MemoryLimit: "256Mi"}
+		clamped, clamps, err := clampConfig(ipagroup, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clamps).To(BeEmpty())
+		Expect(clamped).To(Equal(config))
+	})
+
+	It("should clamp and record out-of-bounds recommendations", func() {
+		config := controller.Config{Replicas: 0, CPURequest: "100m", CPULimit: "4", MemoryRequest: "32Mi", MemoryLimit: "64Ki"}
+		clamped, clamps, err := clampConfig(ipagroup, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clamped.Replicas).To(Equal(int32(2)))
+		Expect(clamped.CPULimit).To(Equal("1"))
+		Expect(clamped.MemoryLimit).To(Equal("128Mi"))
+		Expect(clamps).To(HaveLen(3))
+		Expect(clamps[0].Field).To(Equal("replicas"))
+		Expect(clamps[0].Recommended).To(Equal("0"))
+	})
+
+	It("should keep requests within limits after clamping", func() {
+		cpuFloor, memoryCeiling := resource.MustParse("2"), resource.MustParse("64Mi")
+		bounded := *ipagroup.DeepCopy()
+		bounded.Resources.CPURequest = &ipav1alpha1.QuantityBounds{Min: &cpuFloor}
+		bounded.Resources.MemoryRequest = nil
+		config := controller.Config{Replicas: 3, CPURequest: "100m", CPULimit: "500m", MemoryRequest: "256Mi", MemoryLimit: "512Mi"}
+		_, _, err := clampConfig(bounded, config)
+		Expect(err).To(MatchError("cpuRequest min 2 is greater than cpuLimit max 1"))
+
+		lowerFloor := resource.MustParse("800m")
+		bounded.Resources.CPURequest.Min = &lowerFloor
+		bounded.Resources.MemoryLimit = &ipav1alpha1.QuantityBounds{Max: &memoryCeiling}
+		clamped, clamps, err := clampConfig(bounded, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clamped.CPURequest).To(Equal("800m"))
+		Expect(clamped.CPULimit).To(Equal("800m"))
+		Expect(clamped.MemoryRequest).To(Equal("64Mi"))
+		Expect(clamped.MemoryLimit).To(Equal("64Mi"))
+		Expect(clamps).To(HaveLen(4))
+	})
+
+	It("should reject unparsable quantities", func() {
+		config := controller.Config{Replicas: 3, CPURequest: "lots", CPULimit: "1", MemoryRequest: "1Gi", MemoryLimit: "1Gi"}
+		_, _, err := clampConfig(ipagroup, config)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should clamp per-container recommendations without touching the input", func() {
+		config := controller.Config{Replicas: 3, Containers: map[string]agentv1.ContainerConfig{
+			"app": {CPURequest: "100m", CPULimit: "2", MemoryRequest: "64Mi", MemoryLimit: "256Mi"},
+		}}
+		clamped, clamps, err := clampConfig(ipagroup, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clamped.Containers["app"].CPULimit).To(Equal("1"))
+		Expect(config.Containers["app"].CPULimit).To(Equal("2"))
+		Expect(clamps).To(ConsistOf(HaveField("Container", "app")))
+		Expect(clamps[0].Field).To(Equal("cpuLimit"))
+	})
+})
@@ -18,20 +18,28 @@ package controller
 
 import (
 	"context"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
-	"k8s.io/apimachinery/pkg/api/resource"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 
 	"fmt"
 
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
 	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
 	controller "github.com/shafinhasnat/ipa/internal/agent"
 )
@@ -39,15 +47,33 @@ import (
 // IPAReconciler reconciles a IPA object
 type IPAReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// APIReader reads what is not cached: the metrics.k8s.io API and the
+	// data of Secrets, which are only watched by metadata. The Client is used
+	// when it is nil.
+	APIReader client.Reader
+	// MetricsFileDir is the only directory the StaticFile metrics source may
+	// read from. The source is disabled when it is empty.
+	MetricsFileDir string
+
+	evaluations evaluationLimiter
 }
 
 // +kubebuilder:rbac:groups=ipa.shafinhasnat.me,resources=ipas,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=ipa.shafinhasnat.me,resources=ipas/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=ipa.shafinhasnat.me,resources=ipas/finalizers,verbs=update
-// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;replicasets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=apps,resources=deployments/scale;statefulsets/scale;replicasets/scale,verbs=get;update;patch
+// +kubebuilder:rbac:groups=argoproj.io,resources=rollouts,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=argoproj.io,resources=rollouts/scale,verbs=get;update;patch
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=autoscaling.k8s.io,resources=verticalpodautoscalers,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
-// +kubebuilder:rbac:groups=core,resources=events,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=metrics.k8s.io,resources=pods,verbs=get;list
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=get;list;watch;create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -63,94 +89,443 @@ func (r *IPAReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 	ipa := &ipav1alpha1.IPA{}
 	err := r.Get(ctx, req.NamespacedName, ipa)
 	if err != nil {
+		if apierrors.IsNotFound(err) {
+			r.evaluations.forget(req.NamespacedName)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !ipa.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, ipa)
+	}
+	if err := r.syncFinalizer(ctx, ipa); err != nil {
 		return ctrl.Result{}, err
 	}
-	err = r.IPA(ctx, ipa, req)
-	if err != nil {
-		ipa.Status.Status = string(err.Error())
-		err = r.Status().Update(ctx, ipa)
-		if err != nil {
+	// Watched workloads, pods and events can fire in bursts. Spec changes are
+	// always evaluated right away.
+	if ipa.Generation == ipa.Status.ObservedGeneration {
+		if wait := r.evaluations.wait(req.NamespacedName, time.Now()); wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+	ipa.Status.ObservedGeneration = ipa.Generation
+	requeueAfter, reconcileErr := r.IPA(ctx, ipa, req)
+	if reconcileErr != nil {
+		ipa.Status.Status = reconcileErr.Error()
+		setCondition(ipa, ipav1alpha1.ConditionReady, metav1.ConditionFalse, "ReconcileFailed", reconcileErr.Error())
+		if err := r.Status().Update(ctx, ipa); err != nil {
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, err
+		// Returning the error retries the IPA with backoff.
+		return ctrl.Result{}, reconcileErr
+	}
+	if failed := failedGroups(ipa); len(failed) > 0 {
+		ipa.Status.Status = strings.Join(failed, "; ")
+		setCondition(ipa, ipav1alpha1.ConditionReady, metav1.ConditionFalse, "GroupsFailed", ipa.Status.Status)
+	} else {
+		ipa.Status.Status = "Success"
+		setCondition(ipa, ipav1alpha1.ConditionReady, metav1.ConditionTrue, "Reconciled", "All IPA groups were evaluated")
 	}
-	ipa.Status.Status = "Success"
 	err = r.Status().Update(ctx, ipa)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
-	return ctrl.Result{RequeueAfter: time.Duration(1 * time.Minute)}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
-func (r *IPAReconciler) IPA(ctx context.Context, ipa *ipav1alpha1.IPA, req ctrl.Request) error {
-	prometheus := ipa.Spec.Metadata.PrometheusUri
-	ipagroups := ipa.Spec.Metadata.IPAGroup
-	for _, ipagroup := range ipagroups {
-		deployment := &appsv1.Deployment{}
-		err := r.Get(ctx, types.NamespacedName{Name: ipagroup.Deployment, Namespace: ipagroup.Namespace}, deployment)
-		if err != nil {
-			return fmt.Errorf("error getting deployment: %v", err)
-		}
-		var resourceInfo string
-		for _, container := range deployment.Spec.Template.Spec.Containers {
-			resourceInfo = fmt.Sprintf("CPU Resource Requests: %v, CPU Resource Limits: %v, Memory Resource Requests: %v, Memory Resource Limits: %v",
-				container.Resources.Requests.Cpu().String(),
-				container.Resources.Limits.Cpu().String(),
-				container.Resources.Requests.Memory().String(),
-				container.Resources.Limits.Memory().String())
-		}
-		podList := &corev1.PodList{}
-		err = r.List(ctx, podList, client.InNamespace(ipagroup.Namespace), client.MatchingLabels(deployment.Spec.Selector.MatchLabels))
-		if err != nil {
-			return fmt.Errorf("error getting pods: %v", err)
-		}
-		var podNames []string
-		var events []map[string]string
-		for _, pod := range podList.Items {
-			event := &corev1.EventList{}
-			err = r.List(ctx, event, client.InNamespace(pod.Namespace), client.MatchingFields(map[string]string{"involvedObject.name": pod.Name}))
-			if err != nil {
-				return fmt.Errorf("error getting event: %v", err)
+// Stages of a group reconciliation, used to attribute failures to conditions.
+const (
+	stageTarget  = "Target"
+	stageMetrics = "Metrics"
+	stageAgent   = "Agent"
+	stageApply   = "Apply"
+)
+
+// groupOutcome is the result of reconciling a single IPA group.
+type groupOutcome struct {
+	// stage is where the group failed, empty if it did not.
+	stage string
+	err   error
+	// rejection describes a recommendation that failed validation.
+	rejection string
+	// conflict names the other autoscalers managing the group's workload,
+	// in which case the group was not evaluated.
+	conflict string
+}
+
+// IPA reconciles every group of the IPA independently, so a failure in one
+// group does not stop the others, and returns when the IPA should next be
+// evaluated. It only returns an error if no group could be attempted.
+func (r *IPAReconciler) IPA(ctx context.Context, ipa *ipav1alpha1.IPA, req ctrl.Request) (time.Duration, error) {
+	ipagroups, failedSelectors, discoveryErrors := r.expandGroups(ctx, ipa)
+	r.releaseGroups(ctx, ipa, ipagroups, failedSelectors)
+	setAggregateCondition(ipa, ipav1alpha1.ConditionTargetsDiscovered, discoveryErrors, "DiscoveryFailed",
+		"TargetsDiscovered", fmt.Sprintf("%d workloads are managed", len(ipagroups)))
+	prometheus, err := r.httpClientFor(ctx, ipa, ipa.Spec.Metadata.PrometheusAuth)
+	if err != nil {
+		setCondition(ipa, ipav1alpha1.ConditionMetricsAvailable, metav1.ConditionFalse, "InvalidCredentials", err.Error())
+		return 0, err
+	}
+	defer prometheus.CloseIdleConnections()
+	metrics, err := r.metricsSource(ipa, prometheus)
+	if err != nil {
+		setCondition(ipa, ipav1alpha1.ConditionMetricsAvailable, metav1.ConditionFalse, "InvalidMetricsSource", err.Error())
+		return 0, err
+	}
+	agent, err := r.httpClientFor(ctx, ipa, ipa.Spec.Metadata.LLMAgentAuth)
+	if err != nil {
+		setCondition(ipa, ipav1alpha1.ConditionAgentReachable, metav1.ConditionFalse, "InvalidCredentials", err.Error())
+		return 0, err
+	}
+	defer agent.CloseIdleConnections()
+	recommender, err := recommenderFor(ipa, agent)
+	if err != nil {
+		setCondition(ipa, ipav1alpha1.ConditionAgentReachable, metav1.ConditionFalse, "InvalidProvider", err.Error())
+		return 0, err
+	}
+	groupStatuses := make([]*ipav1alpha1.IPAGroupStatus, len(ipagroups))
+	for i, ipagroup := range ipagroups {
+		groupStatuses[i] = groupStatusFor(ipa, ipagroup).DeepCopy()
+		groupStatuses[i].Discovered = isDiscovered(ipa, ipagroup)
+	}
+	outcomes := make([]groupOutcome, len(ipagroups))
+	semaphore := make(chan struct{}, parallelism(ipa))
+	timeout := groupTimeout(ipa)
+	var wg sync.WaitGroup
+	for i, ipagroup := range ipagroups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				outcomes[i] = groupOutcome{stage: stageTarget, err: ctx.Err()}
+				return
 			}
-			for _, item := range event.Items {
-				events = append(events, map[string]string{"pod": pod.Name, "type": item.Type, "reason": item.Reason, "message": item.Message})
+			groupCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			outcomes[i] = r.reconcileGroup(groupCtx, ipa, metrics, recommender, ipagroup, groupStatuses[i])
+		}()
+	}
+	wg.Wait()
+
+	interval := evaluationInterval(ipa)
+	requeueAfter := interval
+	var metricsErrors, agentErrors, applyErrors, rejections, conflicts []string
+	failures := discoveryErrors
+	for i, ipagroup := range ipagroups {
+		outcome := outcomes[i]
+		groupStatus := groupStatusFor(ipa, ipagroup)
+		*groupStatus = *groupStatuses[i]
+		if outcome.err != nil {
+			groupStatus.Failures++
+			groupStatus.Message = outcome.err.Error()
+			message := fmt.Sprintf("%s: %v", describeTarget(ipagroup.Namespace, scaleTargetRef(ipagroup)), outcome.err)
+			failures = append(failures, message)
+			switch outcome.stage {
+			case stageMetrics:
+				metricsErrors = append(metricsErrors, message)
+			case stageAgent:
+				agentErrors = append(agentErrors, message)
+			case stageApply:
+				applyErrors = append(applyErrors, message)
+			}
+		} else {
+			groupStatus.Failures = 0
+			groupStatus.Message = ""
+		}
+		if outcome.conflict != "" {
+			message := fmt.Sprintf("%s: %s", describeTarget(ipagroup.Namespace, scaleTargetRef(ipagroup)), outcome.conflict)
+			conflicts = append(conflicts, message)
+			// Groups in Recommend mode are still evaluated, so only skipped
+			// groups count as failed.
+			if ipa.Spec.Mode != ipav1alpha1.ModeRecommend {
+				groupStatus.Message = outcome.conflict
+				failures = append(failures, message)
 			}
-			podNames = append(podNames, pod.Name)
 		}
-		prometheusData, err := controller.MetricsBuilder(prometheus, deployment.Name, podNames, ipagroup.Namespace, resourceInfo, events, ipagroup.Ingress)
+		if outcome.rejection != "" {
+			rejections = append(rejections, outcome.rejection)
+		}
+		if groupRequeue := requeueAfterFailures(groupStatus.Failures, interval); groupRequeue < requeueAfter {
+			requeueAfter = groupRequeue
+		}
+	}
+	setAggregateCondition(ipa, ipav1alpha1.ConditionMetricsAvailable, metricsErrors, "MetricsQueryFailed",
+		"MetricsCollected", "Metrics were collected for every evaluated IPA group")
+	setAggregateCondition(ipa, ipav1alpha1.ConditionAgentReachable, agentErrors, "AgentRequestFailed",
+		"RecommendationReceived", "The LLM agent returned a recommendation for every evaluated IPA group")
+	setAggregateCondition(ipa, ipav1alpha1.ConditionRecommendationValid, rejections, "RecommendationRejected",
+		"RecommendationsValid", "Every recommendation passed validation")
+	if len(conflicts) > 0 {
+		setCondition(ipa, ipav1alpha1.ConditionConflict, metav1.ConditionTrue, "TargetConflict", strings.Join(conflicts, "; "))
+	} else {
+		setCondition(ipa, ipav1alpha1.ConditionConflict, metav1.ConditionFalse, "NoConflict", "No other autoscaler manages the IPA's workloads")
+	}
+	switch {
+	case ipa.Spec.Mode == ipav1alpha1.ModeRecommend:
+		setCondition(ipa, ipav1alpha1.ConditionApplied, metav1.ConditionFalse, "RecommendOnly", "IPA is in Recommend mode")
+	case len(applyErrors) > 0:
+		setCondition(ipa, ipav1alpha1.ConditionApplied, metav1.ConditionFalse, "UpdateFailed", strings.Join(applyErrors, "; "))
+	case len(conflicts) > 0:
+		setCondition(ipa, ipav1alpha1.ConditionApplied, metav1.ConditionFalse, "TargetConflict", strings.Join(conflicts, "; "))
+	case len(rejections) > 0:
+		setCondition(ipa, ipav1alpha1.ConditionApplied, metav1.ConditionFalse, "RecommendationRejected", strings.Join(rejections, "; "))
+	case len(failures) > 0:
+		setCondition(ipa, ipav1alpha1.ConditionApplied, metav1.ConditionFalse, "GroupsFailed", strings.Join(failures, "; "))
+	default:
+		setCondition(ipa, ipav1alpha1.ConditionApplied, metav1.ConditionTrue, "Applied", "Recommendations were applied to every IPA group")
+	}
+	return requeueAfter, nil
+}
+
+// reconcileGroup collects metrics for a single group, asks the recommender for
+// a recommendation and applies it to the group's workload. It runs
+// concurrently with other groups, so it only reads the IPA and records its
+// results in groupStatus, which the caller owns.
+func (r *IPAReconciler) reconcileGroup(ctx context.Context, ipa *ipav1alpha1.IPA, metrics controller.MetricsSource, recommender controller.Recommender,
+	ipagroup ipav1alpha1.IPAGroup, groupStatus *ipav1alpha1.IPAGroupStatus) groupOutcome {
+	ref := scaleTargetRef(ipagroup)
+	competitors, err := r.conflictsFor(ctx, ipa, ipagroup.Namespace, ref)
+	if err != nil {
+		return groupOutcome{stage: stageTarget, err: err}
+	}
+	if len(competitors) == 0 {
+		return r.evaluateGroup(ctx, ipa, metrics, recommender, ipagroup, groupStatus)
+	}
+	// Recommend mode never changes the workload, so its recommendations can
+	// still be compared with what the other autoscalers do.
+	recommendOnly := ipa.Spec.Mode == ipav1alpha1.ModeRecommend
+	conflict := fmt.Sprintf("the workload is also managed by %s", strings.Join(competitors, ", "))
+	if !recommendOnly {
+		conflict = "not evaluated, " + conflict
+	}
+	r.Recorder.Event(ipa, corev1.EventTypeWarning, "Conflict",
+		fmt.Sprintf("%s: %s", describeTarget(ipagroup.Namespace, ref), conflict))
+	outcome := groupOutcome{}
+	if recommendOnly {
+		outcome = r.evaluateGroup(ctx, ipa, metrics, recommender, ipagroup, groupStatus)
+	}
+	outcome.conflict = conflict
+	return outcome
+}
+
+// evaluateGroup runs reconcileGroup for a group without conflicts, or one in
+// Recommend mode.
+func (r *IPAReconciler) evaluateGroup(ctx context.Context, ipa *ipav1alpha1.IPA, metrics controller.MetricsSource, recommender controller.Recommender,
+	ipagroup ipav1alpha1.IPAGroup, groupStatus *ipav1alpha1.IPAGroupStatus) groupOutcome {
+	ref := scaleTargetRef(ipagroup)
+	target, err := r.getWorkload(ctx, ipagroup.Namespace, ref)
+	if err != nil {
+		return groupOutcome{stage: stageTarget, err: err}
+	}
+	request := agentv1.NewRequest(agentv1.Target{Kind: ref.Kind, Name: ref.Name, Namespace: ipagroup.Namespace})
+	request.Spec.Replicas = target.replicas
+	request.Spec.ReadyReplicas = target.readyReplicas
+	for _, container := range target.containers {
+		if isExcluded(ipagroup, container.Name) {
+			continue
+		}
+		request.Spec.Containers = append(request.Spec.Containers, containerSpec(container))
+	}
+	podList := &corev1.PodList{}
+	err = r.List(ctx, podList, client.InNamespace(ipagroup.Namespace), client.MatchingLabelsSelector{Selector: target.selector})
+	if err != nil {
+		return groupOutcome{stage: stageTarget, err: fmt.Errorf("error getting pods: %v", err)}
+	}
+	var podNames []string
+	for _, pod := range podList.Items {
+		event := &corev1.EventList{}
+		err = r.List(ctx, event, client.InNamespace(pod.Namespace), client.MatchingFields(map[string]string{"involvedObject.name": pod.Name}))
 		if err != nil {
-			return fmt.Errorf("error querying prometheus: %v", err)
+			return groupOutcome{stage: stageTarget, err: fmt.Errorf("error getting event: %v", err)}
+		}
+		for _, item := range event.Items {
+			request.Events = append(request.Events, agentv1.Event{Pod: pod.Name, Type: item.Type, Reason: item.Reason, Message: item.Message, Count: item.Count})
 		}
-		llmResponse, err := controller.GeminiAPI(ipa.Spec.Metadata.LLMAgent, prometheusData)
+		podNames = append(podNames, pod.Name)
+	}
+	err = metrics.Metrics(ctx, request, metricsOptions(ipagroup, podNames))
+	if err != nil {
+		return groupOutcome{stage: stageMetrics, err: fmt.Errorf("error collecting metrics: %v", err)}
+	}
+	request.Features = controller.ExtractFeatures(request, containerStates(podList.Items))
+	if !ipagroup.RawMetrics {
+		controller.DropSeries(request)
+	}
+	groupStatus.Metrics = &ipav1alpha1.MetricsSummary{
+		Replicas:      target.replicas,
+		ReadyReplicas: target.readyReplicas,
+		Pods:          int32(len(podNames)),
+		Events:        int32(len(request.Events)),
+		Containers:    containerUsage(request.Features),
+		Ingress:       ingressSummary(request.Features),
+		Time:          metav1.Now(),
+	}
+	llmResponse, err := recommender.Recommend(ctx, request)
+	if err != nil {
+		return groupOutcome{stage: stageAgent, err: fmt.Errorf("error querying llm: %v", err)}
+	}
+	config, replicaClamps := clampReplicas(ipagroup, llmResponse.Config)
+	if err := controller.ValidateConfig(config); err != nil {
+		recommendation := recommendationFrom(config)
+		groupStatus.Recommendation = &recommendation
+		groupStatus.Clamps = replicaClamps
+		return groupOutcome{rejection: r.rejectRecommendation(ipa, groupStatus, recommendation, err)}
+	}
+	config, clamps, err := clampConfig(ipagroup, config)
+	if err != nil {
+		return groupOutcome{stage: stageAgent, err: fmt.Errorf("error applying guardrails: %v", err)}
+	}
+	groupStatus.Clamps = append(replicaClamps, clamps...)
+	if err := validateRecommendation(ipagroup, target, config, clamps); err != nil {
+		recommendation := recommendationFrom(config)
+		groupStatus.Recommendation = &recommendation
+		return groupOutcome{rejection: r.rejectRecommendation(ipa, groupStatus, recommendation, err)}
+	}
+	resources, err := desiredResources(ipagroup, target, config)
+	if err != nil {
+		recommendation := recommendationFrom(config)
+		groupStatus.Recommendation = &recommendation
+		return groupOutcome{rejection: r.rejectRecommendation(ipa, groupStatus, recommendation, err)}
+	}
+	now := time.Now()
+	currentReplicas := target.replicas
+	var note string
+	config.Replicas, note = stabilizeReplicas(ipagroup, groupStatus, currentReplicas, config.Replicas, now)
+	recommendation := recommendationFrom(config)
+	groupStatus.Recommendation = &recommendation
+	if ipa.Spec.Mode == ipav1alpha1.ModeRecommend {
+		message := "IPA is in Recommend mode"
+		if note != "" {
+			message += ", " + note
+		}
+		recordDecision(groupStatus, recommendation, false, message)
+		return groupOutcome{}
+	}
+	if groupStatus.Original == nil {
+		// A snapshot on the workload means IPA changed it before but its
+		// status was never saved, so the current values are IPA's own.
+		original, err := originalSnapshot(target)
 		if err != nil {
-			return fmt.Errorf("error querying llm: %v", err)
+			return groupOutcome{stage: stageApply, err: err}
 		}
-		if *deployment.Spec.Replicas != llmResponse.Config.Replicas {
-			deployment.Spec.Replicas = &llmResponse.Config.Replicas
-			err := r.Update(ctx, deployment)
-			if err != nil {
-				return fmt.Errorf("error updating deployment: %v", err)
-			}
+		if original == nil {
+			original = snapshotWorkload(ipagroup, target)
 		}
-		for i := range deployment.Spec.Template.Spec.Containers {
-			container := &deployment.Spec.Template.Spec.Containers[i]
-			container.Resources = corev1.ResourceRequirements{
-				Requests: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse(llmResponse.Config.CPURequest),
-					corev1.ResourceMemory: resource.MustParse(llmResponse.Config.MemoryRequest),
-				},
-				Limits: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse(llmResponse.Config.CPULimit),
-					corev1.ResourceMemory: resource.MustParse(llmResponse.Config.MemoryLimit),
-				},
+		groupStatus.Original = original
+	}
+	if err := r.applyWorkload(ctx, target, config.Replicas, resources, groupStatus.Original); err != nil {
+		recordDecision(groupStatus, recommendation, false, err.Error())
+		return groupOutcome{stage: stageApply, err: err}
+	}
+	if currentReplicas != config.Replicas {
+		recordScale(groupStatus, currentReplicas, config.Replicas, now)
+	}
+	appliedTime := metav1.Now()
+	groupStatus.LastAppliedTime = &appliedTime
+	recordDecision(groupStatus, recommendation, true, note)
+	return groupOutcome{}
+}
+
+// rejectRecommendation records a recommendation that failed validation in the
+// group's history and as a Warning event on the IPA, and returns a short
+// description for the RecommendationValid condition.
+func (r *IPAReconciler) rejectRecommendation(ipa *ipav1alpha1.IPA, groupStatus *ipav1alpha1.IPAGroupStatus, recommendation ipav1alpha1.Recommendation, err error) string {
+	message := fmt.Sprintf("%s: %v", describeTarget(groupStatus.Namespace, groupStatus.ScaleTargetRef), err)
+	recordDecision(groupStatus, recommendation, false, fmt.Sprintf("rejected: %v", err))
+	r.Recorder.Event(ipa, corev1.EventTypeWarning, "RecommendationRejected", message)
+	return message
+}
+
+// recommendationFrom converts an agent recommendation into its status form.
+func recommendationFrom(config controller.Config) ipav1alpha1.Recommendation {
+	recommendation := ipav1alpha1.Recommendation{
+		Replicas:      config.Replicas,
+		CPURequest:    config.CPURequest,
+		CPULimit:      config.CPULimit,
+		MemoryRequest: config.MemoryRequest,
+		MemoryLimit:   config.MemoryLimit,
+		Time:          metav1.Now(),
+	}
+	names := make([]string, 0, len(config.Containers))
+	for name := range config.Containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		container := config.Containers[name]
+		recommendation.Containers = append(recommendation.Containers, ipav1alpha1.ContainerRecommendation{
+			Name:          name,
+			CPURequest:    container.CPURequest,
+			CPULimit:      container.CPULimit,
+			MemoryRequest: container.MemoryRequest,
+			MemoryLimit:   container.MemoryLimit,
+		})
+	}
+	return recommendation
+}
+
+// containerSpec describes the current resources of a container for the agent.
+func containerSpec(container corev1.Container) agentv1.ContainerSpec {
+	spec := agentv1.ContainerSpec{Name: container.Name}
+	if q, ok := container.Resources.Requests[corev1.ResourceCPU]; ok {
+		spec.CPURequest = q.String()
+	}
+	if q, ok := container.Resources.Limits[corev1.ResourceCPU]; ok {
+		spec.CPULimit = q.String()
+	}
+	if q, ok := container.Resources.Requests[corev1.ResourceMemory]; ok {
+		spec.MemoryRequest = q.String()
+	}
+	if q, ok := container.Resources.Limits[corev1.ResourceMemory]; ok {
+		spec.MemoryLimit = q.String()
+	}
+	return spec
+}
+
+// containerStates sums the restarts of each container over pods and notes
+// whether any of them was last terminated for running out of memory.
+func containerStates(pods []corev1.Pod) map[string]controller.ContainerState {
+	states := map[string]controller.ContainerState{}
+	for _, pod := range pods {
+		for _, status := range pod.Status.ContainerStatuses {
+			state := states[status.Name]
+			state.Restarts += status.RestartCount
+			if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.Reason == "OOMKilled" {
+				state.OOMKilled = true
 			}
+			states[status.Name] = state
 		}
-		if err := r.Update(ctx, deployment); err != nil {
-			return fmt.Errorf("failed to update deployment: %v", err)
-		}
+	}
+	return states
+}
 
+// metricsOptions returns the queries to run for the group's pods.
+func metricsOptions(ipagroup ipav1alpha1.IPAGroup, podNames []string) controller.MetricsOptions {
+	options := controller.MetricsOptions{Pods: podNames, Ingress: ipagroup.Ingress, IngressController: string(ipagroup.IngressController)}
+	if window := ipagroup.Window; window != nil {
+		if window.Range != nil {
+			options.Window.Range = window.Range.Duration
+		}
+		if window.Step != nil {
+			options.Window.Step = window.Step.Duration
+		}
+		if window.RateWindow != nil {
+			options.RateWindow = window.RateWindow.Duration
+		}
+		options.MultiResolution = window.MultiResolution
+	}
+	for _, query := range ipagroup.Queries {
+		options.Queries = append(options.Queries, controller.Query{Name: query.Name, Template: query.Query})
+	}
+	for _, name := range ipagroup.DisabledQueries {
+		if options.Disabled == nil {
+			options.Disabled = map[string]bool{}
+		}
+		options.Disabled[string(name)] = true
 	}
-	return nil
+	return options
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -163,8 +538,27 @@ func (r *IPAReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &ipav1alpha1.IPA{}, ipaTargetIndex, ipaTargets); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &ipav1alpha1.IPA{}, ipaSecretIndex, ipaSecrets); err != nil {
+		return err
+	}
+
+	// Workloads created or relabelled to match a target selector, stalled
+	// rollouts, OOM kills, crash loops, scheduling failures and rotated
+	// credentials trigger an evaluation right away instead of at the next interval.
+	workloadPredicates := builder.WithPredicates(predicate.Or[client.Object](predicate.LabelChangedPredicate{}, rolloutStalled))
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&ipav1alpha1.IPA{}).
+		For(&ipav1alpha1.IPA{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(r.ipasForWorkload), workloadPredicates).
+		Watches(&appsv1.StatefulSet{}, handler.EnqueueRequestsFromMapFunc(r.ipasForWorkload), workloadPredicates).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.ipasForPod), builder.WithPredicates(podSignal)).
+		Watches(&corev1.Event{}, handler.EnqueueRequestsFromMapFunc(r.ipasForEvent), builder.WithPredicates(eventSignal)).
+		// Only the metadata of Secrets is cached, their data is read on demand.
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.ipasForSecret), builder.OnlyMetadata,
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})).
 		Named("ipa").
 		Complete(r)
 }
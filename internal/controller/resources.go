@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	controller "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+// managesRequests reports whether the controller sets container requests.
+func managesRequests(controlled ipav1alpha1.ControlledValues) bool {
+	return controlled != ipav1alpha1.ControlledLimitsOnly
+}
+
+// managesLimits reports whether the controller sets container limits directly
+// from the recommendation. ProportionalLimits derives them from the requests.
+func managesLimits(controlled ipav1alpha1.ControlledValues) bool {
+	return controlled != ipav1alpha1.ControlledRequestsOnly && controlled != ipav1alpha1.ControlledProportionalLimits
+}
+
+// desiredResources returns the resource values IPA owns for every managed
+// container of the workload once the recommendation is applied, keyed by
+// container name. Containers that are excluded or have no recommendation are
+// left out, except that values IPA applied before keep their current value,
+// since leaving them out of the apply would delete them from the workload.
+func desiredResources(ipagroup ipav1alpha1.IPAGroup, target *workload, config controller.Config) (map[string]corev1.ResourceRequirements, error) {
+	applied, err := appliedResources(target.object)
+	if err != nil {
+		return nil, err
+	}
+	desired := map[string]corev1.ResourceRequirements{}
+	for _, container := range target.containers {
+		owned := corev1.ResourceRequirements{}
+		containerConfig := config.ForContainer(container.Name)
+		if !isExcluded(ipagroup, container.Name) && !containerConfig.IsEmpty() {
+			resources, err := mergeResources(ipagroup, container.Resources, containerConfig)
+			if err != nil {
+				return nil, fmt.Errorf("container %s: %v", container.Name, err)
+			}
+			owned = ownedResources(ipagroup, resources)
+		}
+		owned.Requests = keepApplied(owned.Requests, container.Resources.Requests, applied[container.Name]["requests"])
+		owned.Limits = keepApplied(owned.Limits, container.Resources.Limits, applied[container.Name]["limits"])
+		if len(owned.Requests) > 0 || len(owned.Limits) > 0 {
+			desired[container.Name] = owned
+		}
+	}
+	return desired, nil
+}
+
+// keepApplied adds the current value of every applied resource that desired
+// leaves out.
+func keepApplied(desired corev1.ResourceList, current corev1.ResourceList, applied []corev1.ResourceName) corev1.ResourceList {
+	for _, name := range applied {
+		if _, ok := desired[name]; ok {
+			continue
+		}
+		value, ok := current[name]
+		if !ok {
+			continue
+		}
+		if desired == nil {
+			desired = corev1.ResourceList{}
+		}
+		desired[name] = value
+	}
+	return desired
+}
+
+// mergeResources sets the CPU and memory values selected by the group's
+// ControlledValues on a copy of current. Every other resource key, such as
+// ephemeral-storage or extended resources, and any claims are kept as they are.
+func mergeResources(ipagroup ipav1alpha1.IPAGroup, current corev1.ResourceRequirements, config agentv1.ContainerConfig) (corev1.ResourceRequirements, error) {
+	merged := *current.DeepCopy()
+	bounds := ipav1alpha1.ResourceBounds{}
+	if ipagroup.Resources != nil {
+		bounds = *ipagroup.Resources
+	}
+	fields := []struct {
+		resource    corev1.ResourceName
+		request     string
+		limit       string
+		limitBounds *ipav1alpha1.QuantityBounds
+		format      resource.Format
+	}{
+		{corev1.ResourceCPU, config.CPURequest, config.CPULimit, bounds.CPULimit, resource.DecimalSI},
+		{corev1.ResourceMemory, config.MemoryRequest, config.MemoryLimit, bounds.MemoryLimit, resource.BinarySI},
+	}
+	for _, field := range fields {
+		request, err := resource.ParseQuantity(field.request)
+		if err != nil {
+			return corev1.ResourceRequirements{}, fmt.Errorf("error parsing %s request %q: %v", field.resource, field.request, err)
+		}
+		limit, err := resource.ParseQuantity(field.limit)
+		if err != nil {
+			return corev1.ResourceRequirements{}, fmt.Errorf("error parsing %s limit %q: %v", field.resource, field.limit, err)
+		}
+		if managesRequests(ipagroup.ControlledValues) {
+			if merged.Requests == nil {
+				merged.Requests = corev1.ResourceList{}
+			}
+			merged.Requests[field.resource] = request
+		}
+		if managesLimits(ipagroup.ControlledValues) {
+			if merged.Limits == nil {
+				merged.Limits = corev1.ResourceList{}
+			}
+			merged.Limits[field.resource] = limit
+		}
+		if ipagroup.ControlledValues == ipav1alpha1.ControlledProportionalLimits {
+			currentLimit, hasLimit := current.Limits[field.resource]
+			if !hasLimit {
+				continue
+			}
+			currentRequest, hasRequest := current.Requests[field.resource]
+			if hasRequest && currentRequest.Sign() > 0 {
+				limit = proportionalLimit(request, currentRequest, currentLimit, field.format)
+				limit, _ = clampQuantity(limit, field.limitBounds)
+			}
+			merged.Limits[field.resource] = limit
+		}
+	}
+	for name, request := range merged.Requests {
+		if limit, ok := merged.Limits[name]; ok && request.Cmp(limit) > 0 {
+			return corev1.ResourceRequirements{}, fmt.Errorf("%s request %s is greater than limit %s", name, request.String(), limit.String())
+		}
+	}
+	return merged, nil
+}
+
+// ownedResources returns the CPU and memory values of merged that the group's
+// ControlledValues hands to IPA, leaving out every other key and claim so they
+// stay owned by whoever set them.
+func ownedResources(ipagroup ipav1alpha1.IPAGroup, merged corev1.ResourceRequirements) corev1.ResourceRequirements {
+	owned := corev1.ResourceRequirements{}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		if request, ok := merged.Requests[name]; ok && managesRequests(ipagroup.ControlledValues) {
+			if owned.Requests == nil {
+				owned.Requests = corev1.ResourceList{}
+			}
+			owned.Requests[name] = request
+		}
+		limit, ok := merged.Limits[name]
+		if ok && (managesLimits(ipagroup.ControlledValues) || ipagroup.ControlledValues == ipav1alpha1.ControlledProportionalLimits) {
+			if owned.Limits == nil {
+				owned.Limits = corev1.ResourceList{}
+			}
+			owned.Limits[name] = limit
+		}
+	}
+	return owned
+}
+
+// proportionalLimit scales request by the ratio between currentLimit and
+// currentRequest, rounding up.
+func proportionalLimit(request resource.Quantity, currentRequest resource.Quantity, currentLimit resource.Quantity, format resource.Format) resource.Quantity {
+	ratio := float64(currentLimit.MilliValue()) / float64(currentRequest.MilliValue())
+	if format == resource.DecimalSI {
+		return *resource.NewMilliQuantity(int64(math.Ceil(float64(request.MilliValue())*ratio)), format)
+	}
+	return *resource.NewQuantity(int64(math.Ceil(float64(request.Value())*ratio)), format)
+}
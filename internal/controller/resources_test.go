@@ -0,0 +1,75 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+var _ = Describe("Resources", func() {
+	gpu := corev1.ResourceName("nvidia.com/gpu")
+	current := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:              resource.MustParse("100m"),
+			corev1.ResourceMemory:           resource.MustParse("128Mi"),
+			corev1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("200m"),
+			corev1.ResourceMemory: resource.MustParse("512Mi"),
+			gpu:                   resource.MustParse("1"),
+		},
+		Claims: []corev1.ResourceClaim{{Name: "accelerator"}},
+	}
+	config := agentv1.ContainerConfig{CPURequest: "300m", CPULimit: "1", MemoryRequest: "256Mi", MemoryLimit: "1Gi"}
+	group := func(controlled ipav1alpha1.ControlledValues) ipav1alpha1.IPAGroup {
+		return ipav1alpha1.IPAGroup{Deployment: "app", Namespace: "default", ControlledValues: controlled}
+	}
+
+	It("should keep resource keys and claims it does not manage", func() {
+		merged, err := mergeResources(group(""), current, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged.Requests).To(HaveKeyWithValue(corev1.ResourceEphemeralStorage, resource.MustParse("1Gi")))
+		Expect(merged.Limits).To(HaveKeyWithValue(gpu, resource.MustParse("1")))
+		Expect(merged.Claims).To(Equal(current.Claims))
+		Expect(merged.Requests[corev1.ResourceCPU]).To(Equal(resource.MustParse("300m")))
+		Expect(merged.Limits[corev1.ResourceMemory]).To(Equal(resource.MustParse("1Gi")))
+		Expect(current.Requests[corev1.ResourceCPU]).To(Equal(resource.MustParse("100m")))
+	})
+
+	It("should only hand the managed values to IPA", func() {
+		merged, err := mergeResources(group(""), current, config)
+		Expect(err).NotTo(HaveOccurred())
+		owned := ownedResources(group(""), merged)
+		Expect(owned.Requests).To(HaveLen(2))
+		Expect(owned.Limits).To(HaveLen(2))
+		Expect(owned.Claims).To(BeEmpty())
+		Expect(ownedResources(group(ipav1alpha1.ControlledLimitsOnly), merged).Requests).To(BeEmpty())
+	})
+
+	It("should only change requests in RequestsOnly mode", func() {
+		requests := agentv1.ContainerConfig{CPURequest: "150m", CPULimit: "1", MemoryRequest: "256Mi", MemoryLimit: "1Gi"}
+		merged, err := mergeResources(group(ipav1alpha1.ControlledRequestsOnly), current, requests)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged.Requests[corev1.ResourceMemory]).To(Equal(resource.MustParse("256Mi")))
+		Expect(merged.Limits[corev1.ResourceMemory]).To(Equal(resource.MustParse("512Mi")))
+	})
+
+	It("should reject requests left above new limits in LimitsOnly mode", func() {
+		small := agentv1.ContainerConfig{CPURequest: "10m", CPULimit: "50m", MemoryRequest: "64Mi", MemoryLimit: "256Mi"}
+		_, err := mergeResources(group(ipav1alpha1.ControlledLimitsOnly), current, small)
+		Expect(err).To(MatchError(ContainSubstring("cpu request 100m is greater than limit 50m")))
+	})
+
+	It("should keep the limit to request ratio in ProportionalLimits mode", func() {
+		merged, err := mergeResources(group(ipav1alpha1.ControlledProportionalLimits), current, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged.Requests[corev1.ResourceCPU]).To(Equal(resource.MustParse("300m")))
+		Expect(merged.Limits.Cpu().MilliValue()).To(Equal(int64(600)))
+		Expect(merged.Limits.Memory().Value()).To(Equal(int64(1 << 30)))
+	})
+})
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+// restoreFinalizer is added to IPAs with RemovalPolicy Restore so their
+// workloads can be restored before the IPA is deleted.
+const restoreFinalizer = "ipa.shafinhasnat.me/restore"
+
+// originalAnnotation holds the JSON encoded snapshot of a workload taken
+// before IPA first changed it. It is written with the first change, so the
+// snapshot survives a status update that never happened.
+const originalAnnotation = "ipa.shafinhasnat.me/original"
+
+// snapshotWorkload records the replica count and the CPU and memory resources
+// of the group's managed containers.
+func snapshotWorkload(ipagroup ipav1alpha1.IPAGroup, w *workload) *ipav1alpha1.WorkloadSnapshot {
+	snapshot := &ipav1alpha1.WorkloadSnapshot{Replicas: w.replicas, Time: metav1.Now()}
+	for _, container := range w.containers {
+		if isExcluded(ipagroup, container.Name) {
+			continue
+		}
+		snapshot.Containers = append(snapshot.Containers, ipav1alpha1.ContainerSnapshot{
+			Name:      container.Name,
+			Resources: cpuAndMemory(container.Resources),
+		})
+	}
+	return snapshot
+}
+
+// cpuAndMemory returns only the CPU and memory requests and limits of resources.
+func cpuAndMemory(resources corev1.ResourceRequirements) corev1.ResourceRequirements {
+	filtered := corev1.ResourceRequirements{}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		if request, ok := resources.Requests[name]; ok {
+			if filtered.Requests == nil {
+				filtered.Requests = corev1.ResourceList{}
+			}
+			filtered.Requests[name] = request
+		}
+		if limit, ok := resources.Limits[name]; ok {
+			if filtered.Limits == nil {
+				filtered.Limits = corev1.ResourceList{}
+			}
+			filtered.Limits[name] = limit
+		}
+	}
+	return filtered
+}
+
+// originalSnapshot returns the snapshot stored on the workload by
+// applyWorkload, or nil if it has none.
+func originalSnapshot(w *workload) (*ipav1alpha1.WorkloadSnapshot, error) {
+	data, ok := w.object.GetAnnotations()[originalAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	snapshot := &ipav1alpha1.WorkloadSnapshot{}
+	if err := json.Unmarshal([]byte(data), snapshot); err != nil {
+		return nil, fmt.Errorf("error reading %s annotation: %v", originalAnnotation, err)
+	}
+	return snapshot, nil
+}
+
+// restoreWorkload applies the snapshot taken before IPA first changed the
+// workload, read from the status or else from the workload's annotation.
+// Values IPA added that were not in the snapshot are dropped, since IPA is
+// their only field manager, and so is the annotation. A workload that no
+// longer exists needs no restoring.
+func (r *IPAReconciler) restoreWorkload(ctx context.Context, groupStatus ipav1alpha1.IPAGroupStatus) error {
+	target, err := r.getWorkload(ctx, groupStatus.Namespace, groupStatus.ScaleTargetRef)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	snapshot := groupStatus.Original
+	if snapshot == nil {
+		if snapshot, err = originalSnapshot(target); err != nil {
+			return err
+		}
+	}
+	if snapshot == nil {
+		return nil
+	}
+	resources := map[string]corev1.ResourceRequirements{}
+	for _, container := range snapshot.Containers {
+		resources[container.Name] = container.Resources
+	}
+	return r.applyWorkload(ctx, target, snapshot.Replicas, resources, nil)
+}
+
+// releaseGroups drops status entries for workloads that are no longer among
+// ipagroups, either because they were removed from the spec or no longer
+// match a target selector. With RemovalPolicy Restore the workloads are
+// restored first, and entries whose restore failed are kept so it is retried.
+// Entries that a selector at one of the failedSelectors indices may own are
+// left alone, since a failed discovery says nothing about their workloads.
+func (r *IPAReconciler) releaseGroups(ctx context.Context, ipa *ipav1alpha1.IPA, ipagroups []ipav1alpha1.IPAGroup, failedSelectors []int) {
+	groups := ipa.Status.Groups[:0]
+	for _, groupStatus := range ipa.Status.Groups {
+		active := false
+		for _, ipagroup := range ipagroups {
+			if isGroupStatus(groupStatus, ipagroup) {
+				active = true
+				break
+			}
+		}
+		for _, i := range failedSelectors {
+			if mayBeSelectedBy(groupStatus, ipa.Spec.Metadata.IPAGroup[i]) {
+				active = true
+				break
+			}
+		}
+		if !active && ipa.Spec.RemovalPolicy == ipav1alpha1.RemovalPolicyRestore {
+			if err := r.restoreWorkload(ctx, groupStatus); err != nil {
+				groupStatus.Message = fmt.Sprintf("error restoring removed workload: %v", err)
+				active = true
+			}
+		}
+		if active {
+			groups = append(groups, groupStatus)
+		}
+	}
+	ipa.Status.Groups = groups
+}
+
+// syncFinalizer adds the restore finalizer to IPAs with RemovalPolicy Restore
+// and removes it from the others.
+func (r *IPAReconciler) syncFinalizer(ctx context.Context, ipa *ipav1alpha1.IPA) error {
+	var changed bool
+	if ipa.Spec.RemovalPolicy == ipav1alpha1.RemovalPolicyRestore {
+		changed = controllerutil.AddFinalizer(ipa, restoreFinalizer)
+	} else {
+		changed = controllerutil.RemoveFinalizer(ipa, restoreFinalizer)
+	}
+	if !changed {
+		return nil
+	}
+	return r.Update(ctx, ipa)
+}
+
+// finalize restores every workload of an IPA being deleted and then releases
+// the IPA by removing the restore finalizer.
+func (r *IPAReconciler) finalize(ctx context.Context, ipa *ipav1alpha1.IPA) error {
+	if !controllerutil.ContainsFinalizer(ipa, restoreFinalizer) {
+		return nil
+	}
+	for _, groupStatus := range ipa.Status.Groups {
+		if err := r.restoreWorkload(ctx, groupStatus); err != nil {
+			message := fmt.Sprintf("%s: %v", describeTarget(groupStatus.Namespace, groupStatus.ScaleTargetRef), err)
+			r.Recorder.Event(ipa, corev1.EventTypeWarning, "RestoreFailed", message)
+			return fmt.Errorf("error restoring %s", message)
+		}
+	}
+	controllerutil.RemoveFinalizer(ipa, restoreFinalizer)
+	return r.Update(ctx, ipa)
+}
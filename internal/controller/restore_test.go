@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+var _ = Describe("Restore", func() {
+	ctx := context.Background()
+	scheme := newScheme()
+
+	removed := ipav1alpha1.IPAGroupStatus{
+		ScaleTargetRef: scaleTargetRef(ipav1alpha1.IPAGroup{Deployment: "gone"}),
+		Namespace:      "default",
+		Original:       &ipav1alpha1.WorkloadSnapshot{Replicas: 3},
+	}
+
+	// original is the workload before IPA changed it, and changed is the
+	// workload IPA left behind, carrying original in its annotation.
+	original := &ipav1alpha1.WorkloadSnapshot{Replicas: 2, Containers: []ipav1alpha1.ContainerSnapshot{{
+		Name: "app",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+		},
+	}}}
+	changed := func() *appsv1.Deployment {
+		replicas := int32(5)
+		labels := map[string]string{"app": "app"}
+		data, err := json.Marshal(original)
+		Expect(err).NotTo(HaveOccurred())
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Annotations: map[string]string{originalAnnotation: string(data)}},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("300m"), corev1.ResourceMemory: resource.MustParse("96Mi")},
+						Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("600m"), corev1.ResourceMemory: resource.MustParse("256Mi")},
+					}}}},
+				},
+			},
+		}
+	}
+	managed := ipav1alpha1.IPAGroupStatus{
+		ScaleTargetRef: scaleTargetRef(ipav1alpha1.IPAGroup{Deployment: "app"}),
+		Namespace:      "default",
+	}
+	// newReconciler returns a reconciler for a fake cluster holding objects.
+	// The fake client supports neither server-side apply nor the scale
+	// subresource of an unstructured workload, so applies are recorded in
+	// applied, or fail with applyErr, and the scale is read from the Deployment.
+	var applied []*unstructured.Unstructured
+	var applyErr error
+	newReconciler := func(objects ...client.Object) *IPAReconciler {
+		applied, applyErr = nil, nil
+		return &IPAReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).
+				WithInterceptorFuncs(interceptor.Funcs{
+					SubResourceGet: func(ctx context.Context, c client.Client, _ string, obj client.Object, subResource client.Object, _ ...client.SubResourceGetOption) error {
+						deployment := &appsv1.Deployment{}
+						if err := c.Get(ctx, client.ObjectKeyFromObject(obj), deployment); err != nil {
+							return err
+						}
+						scale := subResource.(*unstructured.Unstructured)
+						scale.Object["spec"] = map[string]interface{}{"replicas": int64(*deployment.Spec.Replicas)}
+						scale.Object["status"] = map[string]interface{}{"selector": "app=" + deployment.Name}
+						return nil
+					},
+					Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+						if patch != client.Apply {
+							return c.Patch(ctx, obj, patch, opts...)
+						}
+						if applyErr != nil {
+							return applyErr
+						}
+						applied = append(applied, obj.(*unstructured.Unstructured).DeepCopy())
+						return nil
+					},
+				}).Build(),
+			Recorder: record.NewFakeRecorder(10),
+		}
+	}
+	// expectRestored checks that the only apply put back original and
+	// dropped the annotation.
+	expectRestored := func() {
+		Expect(applied).To(HaveLen(1))
+		Expect(applied[0].GetName()).To(Equal("app"))
+		Expect(applied[0].GetAnnotations()).NotTo(HaveKey(originalAnnotation))
+		deployment := &appsv1.Deployment{}
+		Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(applied[0].Object, deployment)).To(Succeed())
+		Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+		Expect(deployment.Spec.Template.Spec.Containers).To(HaveLen(1))
+		Expect(deployment.Spec.Template.Spec.Containers[0].Resources).To(Equal(original.Containers[0].Resources))
+	}
+
+	It("should snapshot only the CPU and memory of managed containers", func() {
+		ipagroup := ipav1alpha1.IPAGroup{Deployment: "app", Namespace: "default", ExcludeContainers: []string{"sidecar"}}
+		target := &workload{replicas: 3, containers: []corev1.Container{
+			{Name: "app", Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:              resource.MustParse("100m"),
+					corev1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+				},
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+			}},
+			{Name: "sidecar"},
+		}}
+		snapshot := snapshotWorkload(ipagroup, target)
+		Expect(snapshot.Replicas).To(Equal(int32(3)))
+		Expect(snapshot.Containers).To(HaveLen(1))
+		Expect(snapshot.Containers[0].Resources.Requests).To(HaveLen(1))
+		Expect(snapshot.Containers[0].Resources.Limits).To(HaveKey(corev1.ResourceMemory))
+	})
+
+	It("should restore the snapshot in the annotation and remove the annotation", func() {
+		reconciler := newReconciler(changed())
+		Expect(reconciler.restoreWorkload(ctx, managed)).To(Succeed())
+		expectRestored()
+	})
+
+	It("should restore removed groups with RemovalPolicy Restore", func() {
+		reconciler := newReconciler(changed())
+		ipa := &ipav1alpha1.IPA{}
+		ipa.Spec.RemovalPolicy = ipav1alpha1.RemovalPolicyRestore
+		restored := managed
+		restored.Original = original
+		ipa.Status.Groups = []ipav1alpha1.IPAGroupStatus{restored}
+		reconciler.releaseGroups(ctx, ipa, nil, nil)
+		Expect(ipa.Status.Groups).To(BeEmpty())
+		expectRestored()
+
+		ipa.Status.Groups = []ipav1alpha1.IPAGroupStatus{restored}
+		applyErr = errors.New("conflict")
+		reconciler.releaseGroups(ctx, ipa, nil, nil)
+		Expect(ipa.Status.Groups).To(ConsistOf(HaveField("Message", ContainSubstring("error restoring removed workload"))))
+
+		ipa.Spec.RemovalPolicy = ipav1alpha1.RemovalPolicyRetain
+		applied, applyErr = nil, nil
+		reconciler.releaseGroups(ctx, ipa, nil, nil)
+		Expect(ipa.Status.Groups).To(BeEmpty())
+		Expect(applied).To(BeEmpty())
+	})
+
+	It("should drop removed groups whose workload no longer exists", func() {
+		reconciler := &IPAReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build()}
+		ipa := &ipav1alpha1.IPA{}
+		ipa.Spec.RemovalPolicy = ipav1alpha1.RemovalPolicyRestore
+		ipa.Status.Groups = []ipav1alpha1.IPAGroupStatus{removed}
+		reconciler.releaseGroups(ctx, ipa, nil, nil)
+		Expect(ipa.Status.Groups).To(BeEmpty())
+	})
+
+	It("should release a deleted IPA once its workloads are restored", func() {
+		now := metav1.Now()
+		ipa := &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{
+			Name:              "web",
+			Namespace:         "default",
+			Finalizers:        []string{restoreFinalizer},
+			DeletionTimestamp: &now,
+		}}
+		ipa.Spec.RemovalPolicy = ipav1alpha1.RemovalPolicyRestore
+		ipa.Status.Groups = []ipav1alpha1.IPAGroupStatus{removed}
+		reconciler := &IPAReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(ipa).Build(),
+			Recorder: record.NewFakeRecorder(10),
+		}
+		Expect(reconciler.finalize(ctx, ipa)).To(Succeed())
+		err := reconciler.Get(ctx, types.NamespacedName{Name: "web", Namespace: "default"}, &ipav1alpha1.IPA{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should restore the workloads of a deleted IPA before releasing it", func() {
+		now := metav1.Now()
+		ipa := &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{
+			Name:              "web",
+			Namespace:         "default",
+			Finalizers:        []string{restoreFinalizer},
+			DeletionTimestamp: &now,
+		}}
+		ipa.Spec.RemovalPolicy = ipav1alpha1.RemovalPolicyRestore
+		ipa.Status.Groups = []ipav1alpha1.IPAGroupStatus{managed}
+		reconciler := newReconciler(ipa, changed())
+
+		applyErr = errors.New("conflict")
+		Expect(reconciler.finalize(ctx, ipa)).NotTo(Succeed())
+		Expect(reconciler.Get(ctx, types.NamespacedName{Name: "web", Namespace: "default"}, &ipav1alpha1.IPA{})).To(Succeed())
+
+		applyErr = nil
+		Expect(reconciler.finalize(ctx, ipa)).To(Succeed())
+		expectRestored()
+		err := reconciler.Get(ctx, types.NamespacedName{Name: "web", Namespace: "default"}, &ipav1alpha1.IPA{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should only keep the finalizer with RemovalPolicy Restore", func() {
+		ipa := &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+		ipa.Spec.RemovalPolicy = ipav1alpha1.RemovalPolicyRestore
+		reconciler := &IPAReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(ipa).Build()}
+		Expect(reconciler.syncFinalizer(ctx, ipa)).To(Succeed())
+		Expect(ipa.Finalizers).To(ConsistOf(restoreFinalizer))
+		ipa.Spec.RemovalPolicy = ipav1alpha1.RemovalPolicyRetain
+		Expect(reconciler.syncFinalizer(ctx, ipa)).To(Succeed())
+		Expect(ipa.Finalizers).To(BeEmpty())
+	})
+})
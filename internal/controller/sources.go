@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	controller "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+// metricsSource returns the MetricsSource selected by the IPA. Prometheus
+// queries are sent with the given client.
+func (r *IPAReconciler) metricsSource(ipa *ipav1alpha1.IPA, prometheus *http.Client) (controller.MetricsSource, error) {
+	switch ipa.Spec.Metadata.MetricsSource {
+	case "", ipav1alpha1.MetricsSourcePrometheus:
+		return &controller.Prometheus{URL: ipa.Spec.Metadata.PrometheusUri, Client: prometheus}, nil
+	case ipav1alpha1.MetricsSourceMetricsServer:
+		return &controller.MetricsServer{Reader: r.apiReader()}, nil
+	case ipav1alpha1.MetricsSourceStaticFile:
+		path, err := r.metricsFilePath(ipa.Spec.Metadata.MetricsFile)
+		if err != nil {
+			return nil, err
+		}
+		return &controller.StaticFile{Path: path}, nil
+	default:
+		return nil, fmt.Errorf("unknown metrics source: %s", ipa.Spec.Metadata.MetricsSource)
+	}
+}
+
+// metricsFilePath resolves the file of the StaticFile source against
+// MetricsFileDir and rejects files outside of it, so IPAs cannot read
+// arbitrary files of the controller.
+func (r *IPAReconciler) metricsFilePath(file string) (string, error) {
+	if r.MetricsFileDir == "" {
+		return "", fmt.Errorf("the StaticFile metrics source is disabled, start the controller with --metrics-file-dir to enable it")
+	}
+	dir := filepath.Clean(r.MetricsFileDir)
+	path := file
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	rel, err := filepath.Rel(dir, filepath.Clean(path))
+	if err != nil || rel == "." || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("metrics file %s is outside of %s", file, dir)
+	}
+	return filepath.Join(dir, rel), nil
+}
+
+// apiReader returns the APIReader, or the Client when it is not set.
+func (r *IPAReconciler) apiReader() client.Reader {
+	if r.APIReader == nil {
+		return r.Client
+	}
+	return r.APIReader
+}
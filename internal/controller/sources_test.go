@@ -0,0 +1,38 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	controller "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+var _ = Describe("Metrics sources", func() {
+	ipa := &ipav1alpha1.IPA{}
+	ipa.Spec.Metadata.MetricsSource = ipav1alpha1.MetricsSourceStaticFile
+	ipa.Spec.Metadata.MetricsFile = "/metrics/web.json"
+
+	It("should only read static files when a directory is configured", func() {
+		reconciler := &IPAReconciler{}
+		_, err := reconciler.metricsSource(ipa, nil)
+		Expect(err).To(MatchError(ContainSubstring("the StaticFile metrics source is disabled")))
+
+		reconciler.MetricsFileDir = "/metrics/"
+		source, err := reconciler.metricsSource(ipa, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal(&controller.StaticFile{Path: "/metrics/web.json"}))
+	})
+
+	It("should reject static files outside of the directory", func() {
+		reconciler := &IPAReconciler{MetricsFileDir: "/metrics"}
+		path, err := reconciler.metricsFilePath("shop/web.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(path).To(Equal("/metrics/shop/web.json"))
+
+		for _, file := range []string{"/var/run/secrets/kubernetes.io/serviceaccount/token", "../etc/passwd", "/metrics/../etc/passwd", "/metrics-other/web.json"} {
+			_, err := reconciler.metricsFilePath(file)
+			Expect(err).To(MatchError(ContainSubstring("is outside of /metrics")), file)
+		}
+	})
+})
@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	controller "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+// decisionHistoryLimit is the number of decisions kept per group in status.
+const decisionHistoryLimit = 10
+
+const (
+	// defaultRequeueInterval is how often an IPA is evaluated when it does not set an interval.
+	defaultRequeueInterval = 1 * time.Minute
+	// failureRequeueInterval is the first retry delay for a failing group. It
+	// doubles with each consecutive failure up to the evaluation interval.
+	failureRequeueInterval = 15 * time.Second
+	// defaultParallelism is the number of groups evaluated at once when the IPA does not set one.
+	defaultParallelism = 4
+	// defaultGroupTimeout bounds a single group's evaluation when the IPA does not set one.
+	defaultGroupTimeout = 2 * time.Minute
+)
+
+// evaluationInterval returns how often the IPA should be evaluated.
+func evaluationInterval(ipa *ipav1alpha1.IPA) time.Duration {
+	if ipa.Spec.Interval == nil || ipa.Spec.Interval.Duration <= 0 {
+		return defaultRequeueInterval
+	}
+	return ipa.Spec.Interval.Duration
+}
+
+// parallelism returns the number of groups of the IPA to evaluate at once.
+func parallelism(ipa *ipav1alpha1.IPA) int {
+	if ipa.Spec.Parallelism == nil || *ipa.Spec.Parallelism < 1 {
+		return defaultParallelism
+	}
+	return int(*ipa.Spec.Parallelism)
+}
+
+// groupTimeout returns the deadline for evaluating a single group of the IPA.
+func groupTimeout(ipa *ipav1alpha1.IPA) time.Duration {
+	if ipa.Spec.GroupTimeout == nil || ipa.Spec.GroupTimeout.Duration <= 0 {
+		return defaultGroupTimeout
+	}
+	return ipa.Spec.GroupTimeout.Duration
+}
+
+// groupStatusFor returns the status entry for the group, creating it if the
+// group has not been reported yet. The returned pointer is only valid until
+// the next call, since adding an entry may reallocate the slice.
+func groupStatusFor(ipa *ipav1alpha1.IPA, ipagroup ipav1alpha1.IPAGroup) *ipav1alpha1.IPAGroupStatus {
+	for i := range ipa.Status.Groups {
+		existing := &ipa.Status.Groups[i]
+		if isGroupStatus(*existing, ipagroup) {
+			return existing
+		}
+	}
+	ipa.Status.Groups = append(ipa.Status.Groups, ipav1alpha1.IPAGroupStatus{
+		ScaleTargetRef: scaleTargetRef(ipagroup),
+		Namespace:      ipagroup.Namespace,
+	})
+	return &ipa.Status.Groups[len(ipa.Status.Groups)-1]
+}
+
+// isGroupStatus reports whether the status entry belongs to the group.
+func isGroupStatus(groupStatus ipav1alpha1.IPAGroupStatus, ipagroup ipav1alpha1.IPAGroup) bool {
+	return groupStatus.ScaleTargetRef == scaleTargetRef(ipagroup) && groupStatus.Namespace == ipagroup.Namespace
+}
+
+// recordDecision appends a decision to the group's history, dropping the
+// oldest entries once the history exceeds decisionHistoryLimit.
+func recordDecision(groupStatus *ipav1alpha1.IPAGroupStatus, recommendation ipav1alpha1.Recommendation, applied bool, message string) {
+	groupStatus.History = append(groupStatus.History, ipav1alpha1.Decision{
+		Recommendation: recommendation,
+		Applied:        applied,
+		Message:        message,
+	})
+	if overflow := len(groupStatus.History) - decisionHistoryLimit; overflow > 0 {
+		groupStatus.History = groupStatus.History[overflow:]
+	}
+}
+
+// containerUsage summarizes the CPU and memory usage of each container in
+// the features, skipping containers without usage data.
+func containerUsage(features *agentv1.Features) []ipav1alpha1.ContainerUsage {
+	var usage []ipav1alpha1.ContainerUsage
+	for _, container := range features.Containers {
+		if container.CPU == nil && container.Memory == nil {
+			continue
+		}
+		summary := ipav1alpha1.ContainerUsage{Name: container.Name}
+		if cpu := container.CPU; cpu != nil {
+			summary.CPUAvg = resource.NewMilliQuantity(int64(math.Round(cpu.Avg*1000)), resource.DecimalSI)
+			summary.CPUP95 = resource.NewMilliQuantity(int64(math.Round(cpu.P95*1000)), resource.DecimalSI)
+		}
+		if memory := container.Memory; memory != nil {
+			summary.MemoryAvg = resource.NewQuantity(int64(math.Round(memory.Avg)), resource.BinarySI)
+			summary.MemoryP95 = resource.NewQuantity(int64(math.Round(memory.P95)), resource.BinarySI)
+		}
+		usage = append(usage, summary)
+	}
+	return usage
+}
+
+// ingressSummary averages the ingress signals in the features, or returns
+// nil when there are none.
+func ingressSummary(features *agentv1.Features) *ipav1alpha1.IngressSummary {
+	summary := &ipav1alpha1.IngressSummary{}
+	for _, metric := range features.Metrics {
+		if metric.Context || metric.Custom {
+			continue
+		}
+		switch metric.Name {
+		case controller.QueryIngressRequests:
+			summary.RequestRate = strconv.FormatFloat(metric.Avg, 'g', 4, 64)
+		case controller.QueryIngressErrorRatio:
+			summary.ErrorRatio = strconv.FormatFloat(metric.Avg, 'g', 4, 64)
+		case controller.MetricIngressDurationP95:
+			latency := time.Duration(metric.Avg * float64(time.Second)).Round(time.Millisecond)
+			summary.LatencyP95 = &metav1.Duration{Duration: latency}
+		}
+	}
+	if *summary == (ipav1alpha1.IngressSummary{}) {
+		return nil
+	}
+	return summary
+}
+
+// requeueAfterFailures returns how soon a group with the given number of
+// consecutive failures should be retried, never later than interval.
+func requeueAfterFailures(failures int32, interval time.Duration) time.Duration {
+	if failures == 0 {
+		return interval
+	}
+	requeueAfter := failureRequeueInterval
+	for i := int32(1); i < failures && requeueAfter < interval; i++ {
+		requeueAfter *= 2
+	}
+	return min(requeueAfter, interval)
+}
+
+// failedGroups describes every group whose last reconciliation failed,
+// including target selectors that could not be expanded.
+func failedGroups(ipa *ipav1alpha1.IPA) []string {
+	var failed []string
+	if meta.IsStatusConditionFalse(ipa.Status.Conditions, ipav1alpha1.ConditionTargetsDiscovered) {
+		failed = append(failed, meta.FindStatusCondition(ipa.Status.Conditions, ipav1alpha1.ConditionTargetsDiscovered).Message)
+	}
+	for _, groupStatus := range ipa.Status.Groups {
+		if groupStatus.Message != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", describeTarget(groupStatus.Namespace, groupStatus.ScaleTargetRef), groupStatus.Message))
+		}
+	}
+	return failed
+}
+
+// setAggregateCondition sets a condition that is False when any group
+// reported a problem, listing every problem in the message.
+func setAggregateCondition(ipa *ipav1alpha1.IPA, conditionType string, problems []string, falseReason string, trueReason string, trueMessage string) {
+	if len(problems) > 0 {
+		setCondition(ipa, conditionType, metav1.ConditionFalse, falseReason, strings.Join(problems, "; "))
+		return
+	}
+	setCondition(ipa, conditionType, metav1.ConditionTrue, trueReason, trueMessage)
+}
+
+// setCondition sets a condition on the IPA, stamped with its current generation.
+func setCondition(ipa *ipav1alpha1.IPA, conditionType string, status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&ipa.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: ipa.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
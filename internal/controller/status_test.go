@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	controller "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+var _ = Describe("Status", func() {
+	It("should keep only the most recent decisions", func() {
+		groupStatus := &ipav1alpha1.IPAGroupStatus{}
+		for i := 1; i <= decisionHistoryLimit+3; i++ {
+			recordDecision(groupStatus, ipav1alpha1.Recommendation{Replicas: int32(i)}, true, "")
+		}
+		Expect(groupStatus.History).To(HaveLen(decisionHistoryLimit))
+		Expect(groupStatus.History[0].Replicas).To(Equal(int32(4)))
+		Expect(groupStatus.History[decisionHistoryLimit-1].Replicas).To(Equal(int32(decisionHistoryLimit + 3)))
+	})
+
+	It("should drop status for groups removed from the spec", func() {
+		ipa := &ipav1alpha1.IPA{}
+		ipa.Spec.Metadata.IPAGroup = []ipav1alpha1.IPAGroup{{Deployment: "kept", Namespace: "default"}}
+		ipa.Status.Groups = []ipav1alpha1.IPAGroupStatus{
+			{ScaleTargetRef: scaleTargetRef(ipav1alpha1.IPAGroup{Deployment: "removed"}), Namespace: "default"},
+			{ScaleTargetRef: scaleTargetRef(ipav1alpha1.IPAGroup{Deployment: "kept"}), Namespace: "default"},
+		}
+		(&IPAReconciler{}).releaseGroups(context.Background(), ipa, ipa.Spec.Metadata.IPAGroup, nil)
+		Expect(ipa.Status.Groups).To(HaveLen(1))
+		Expect(groupStatusFor(ipa, ipa.Spec.Metadata.IPAGroup[0])).To(Equal(&ipa.Status.Groups[0]))
+	})
+
+	It("should keep status for workloads of selectors whose discovery failed", func() {
+		ipa := &ipav1alpha1.IPA{}
+		ipa.Spec.RemovalPolicy = ipav1alpha1.RemovalPolicyRestore
+		ipa.Spec.Metadata.IPAGroup = []ipav1alpha1.IPAGroup{{
+			Namespace:      "shop",
+			TargetSelector: &ipav1alpha1.TargetSelector{},
+		}}
+		discovered := ipav1alpha1.IPAGroupStatus{
+			ScaleTargetRef: scaleTargetRef(ipav1alpha1.IPAGroup{Deployment: "cart"}),
+			Namespace:      "shop",
+			Discovered:     true,
+			Original:       &ipav1alpha1.WorkloadSnapshot{Replicas: 3},
+			History:        []ipav1alpha1.Decision{{Recommendation: ipav1alpha1.Recommendation{Replicas: 5}, Applied: true}},
+		}
+		elsewhere := discovered
+		elsewhere.Namespace = "blog"
+		elsewhere.Original = nil
+		ipa.Status.Groups = []ipav1alpha1.IPAGroupStatus{discovered, elsewhere}
+		reconciler := &IPAReconciler{Client: fake.NewClientBuilder().Build()}
+		reconciler.releaseGroups(context.Background(), ipa, nil, []int{0})
+		Expect(ipa.Status.Groups).To(Equal([]ipav1alpha1.IPAGroupStatus{discovered}))
+	})
+
+	It("should tell apart workloads of different kinds with the same name", func() {
+		ipa := &ipav1alpha1.IPA{}
+		statefulSet := ipav1alpha1.IPAGroup{
+			ScaleTargetRef: &autoscalingv2.CrossVersionObjectReference{Kind: "StatefulSet", Name: "db"},
+			Namespace:      "default",
+		}
+		deployment := ipav1alpha1.IPAGroup{Deployment: "db", Namespace: "default"}
+		groupStatusFor(ipa, statefulSet)
+		groupStatusFor(ipa, deployment)
+		Expect(ipa.Status.Groups).To(HaveLen(2))
+		Expect(ipa.Status.Groups[0].ScaleTargetRef.APIVersion).To(Equal("apps/v1"))
+	})
+
+	It("should retry failing groups sooner and back off with repeated failures", func() {
+		Expect(requeueAfterFailures(0, time.Minute)).To(Equal(time.Minute))
+		Expect(requeueAfterFailures(1, time.Minute)).To(Equal(15 * time.Second))
+		Expect(requeueAfterFailures(2, time.Minute)).To(Equal(30 * time.Second))
+		Expect(requeueAfterFailures(10, time.Minute)).To(Equal(time.Minute))
+		Expect(requeueAfterFailures(1, 10*time.Second)).To(Equal(10 * time.Second))
+	})
+
+	It("should summarize the observed container usage and ingress traffic", func() {
+		features := &agentv1.Features{
+			Metrics: []agentv1.MetricFeatures{
+				{Name: controller.QueryIngressRequests, Stats: agentv1.Stats{Avg: 12.345}},
+				{Name: controller.MetricIngressDurationP95, Stats: agentv1.Stats{Avg: 0.2504}},
+				{Name: controller.QueryIngressRequests, Context: true, Stats: agentv1.Stats{Avg: 99}},
+			},
+			Containers: []agentv1.ContainerFeatures{
+				{Name: "app", CPU: &agentv1.Utilization{Avg: 0.1204, P95: 0.25}, Memory: &agentv1.Utilization{Avg: 64 << 20, P95: 96 << 20}},
+				{Name: "sidecar"},
+			},
+		}
+		usage := containerUsage(features)
+		Expect(usage).To(HaveLen(1))
+		Expect(usage[0].Name).To(Equal("app"))
+		Expect(usage[0].CPUAvg.Equal(resource.MustParse("120m"))).To(BeTrue())
+		Expect(usage[0].CPUP95.Equal(resource.MustParse("250m"))).To(BeTrue())
+		Expect(usage[0].MemoryAvg.Equal(resource.MustParse("64Mi"))).To(BeTrue())
+		Expect(usage[0].MemoryP95.Equal(resource.MustParse("96Mi"))).To(BeTrue())
+
+		ingress := ingressSummary(features)
+		Expect(ingress.RequestRate).To(Equal("12.35"))
+		Expect(ingress.ErrorRatio).To(BeEmpty())
+		Expect(ingress.LatencyP95.Duration).To(Equal(250 * time.Millisecond))
+		Expect(ingressSummary(&agentv1.Features{Containers: features.Containers})).To(BeNil())
+	})
+})
@@ -26,6 +26,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -46,6 +47,15 @@ var testEnv *envtest.Environment
 var ctx context.Context
 var cancel context.CancelFunc
 
+// newScheme returns a scheme holding the client-go and IPA types, for the
+// fake clients of the unit tests.
+func newScheme() *k8sruntime.Scheme {
+	s := k8sruntime.NewScheme()
+	Expect(scheme.AddToScheme(s)).To(Succeed())
+	Expect(ipav1alpha1.AddToScheme(s)).To(Succeed())
+	return s
+}
+
 func TestControllers(t *testing.T) {
 	RegisterFailHandler(Fail)
 
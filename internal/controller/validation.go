@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	controller "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+// validateRecommendation rejects recommendations that move further from the
+// workload's current values than the group's step limits allow. Fields that
+// were clamped to the group's bounds are exempt, since the bounds take priority,
+// as are values the group does not manage.
+func validateRecommendation(ipagroup ipav1alpha1.IPAGroup, target *workload, config controller.Config, clamps []ipav1alpha1.Clamp) error {
+	limits := ipagroup.StepLimits
+	if limits == nil {
+		return nil
+	}
+	clamped := map[string]bool{}
+	for _, clamp := range clamps {
+		clamped[clamp.Container+"/"+clamp.Field] = true
+	}
+
+	if !clamped["/replicas"] {
+		current := int64(target.replicas)
+		if err := checkStep("replicas", current, int64(config.Replicas), limits.MaxReplicaIncreasePercent, limits.MaxReplicaDecreasePercent); err != nil {
+			return err
+		}
+	}
+
+	for _, container := range target.containers {
+		if isExcluded(ipagroup, container.Name) {
+			continue
+		}
+		// Containers without their own entry take the top-level defaults,
+		// so clamps recorded against the defaults apply to them.
+		clampKey := ""
+		if _, ok := config.Containers[container.Name]; ok {
+			clampKey = container.Name
+		}
+		recommendation := config.ForContainer(container.Name)
+		if recommendation.IsEmpty() {
+			continue
+		}
+		managedRequests, managedLimits := managesRequests(ipagroup.ControlledValues), managesLimits(ipagroup.ControlledValues)
+		fields := []struct {
+			name      string
+			value     string
+			managed   bool
+			resources func(corev1.ResourceRequirements) corev1.ResourceList
+			resource  corev1.ResourceName
+		}{
+			{"cpuRequest", recommendation.CPURequest, managedRequests, requestsOf, corev1.ResourceCPU},
+			{"cpuLimit", recommendation.CPULimit, managedLimits, limitsOf, corev1.ResourceCPU},
+			{"memoryRequest", recommendation.MemoryRequest, managedRequests, requestsOf, corev1.ResourceMemory},
+			{"memoryLimit", recommendation.MemoryLimit, managedLimits, limitsOf, corev1.ResourceMemory},
+		}
+		for _, field := range fields {
+			if !field.managed || clamped[clampKey+"/"+field.name] {
+				continue
+			}
+			current, ok := field.resources(container.Resources)[field.resource]
+			if !ok {
+				continue
+			}
+			recommended, err := resource.ParseQuantity(field.value)
+			if err != nil {
+				return fmt.Errorf("container %s: error parsing %s %q: %v", container.Name, field.name, field.value, err)
+			}
+			err = checkStep(field.name, current.MilliValue(), recommended.MilliValue(), limits.MaxResourceIncreasePercent, limits.MaxResourceDecreasePercent)
+			if err != nil {
+				return fmt.Errorf("container %s: %v", container.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// isExcluded reports whether the group leaves the named container's resources alone.
+func isExcluded(ipagroup ipav1alpha1.IPAGroup, container string) bool {
+	for _, name := range ipagroup.ExcludeContainers {
+		if name == container {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStep returns an error if moving from current to recommended exceeds
+// the given increase or decrease percentage. A nil limit disables the check.
+func checkStep(name string, current int64, recommended int64, maxIncreasePercent *int32, maxDecreasePercent *int32) error {
+	if current <= 0 {
+		return nil
+	}
+	if maxIncreasePercent != nil && recommended > current {
+		if (recommended-current)*100 > current*int64(*maxIncreasePercent) {
+			return fmt.Errorf("%s increase from %d to %d exceeds %d%%", name, current, recommended, *maxIncreasePercent)
+		}
+	}
+	if maxDecreasePercent != nil && recommended < current {
+		if (current-recommended)*100 > current*int64(*maxDecreasePercent) {
+			return fmt.Errorf("%s decrease from %d to %d exceeds %d%%", name, current, recommended, *maxDecreasePercent)
+		}
+	}
+	return nil
+}
+
+func requestsOf(resources corev1.ResourceRequirements) corev1.ResourceList {
+	return resources.Requests
+}
+
+func limitsOf(resources corev1.ResourceRequirements) corev1.ResourceList {
+	return resources.Limits
+}
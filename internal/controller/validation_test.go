@@ -0,0 +1,69 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	controller "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+var _ = Describe("Validation", func() {
+	increase, decrease := int32(100), int32(50)
+	ipagroup := ipav1alpha1.IPAGroup{
+		Deployment: "app",
+		Namespace:  "default",
+		StepLimits: &ipav1alpha1.StepLimits{
+			MaxReplicaIncreasePercent:  &increase,
+			MaxResourceDecreasePercent: &decrease,
+		},
+	}
+	target := &workload{
+		replicas: 4,
+		containers: []corev1.Container{{
+			Name: "app",
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			},
+		}},
+	}
+	config := func(replicas int32, memoryLimit string) controller.Config {
+		return controller.Config{Replicas: replicas, CPURequest: "100m", CPULimit: "200m", MemoryRequest: "128Mi", MemoryLimit: memoryLimit}
+	}
+
+	It("should accept changes within the step limits", func() {
+		Expect(validateRecommendation(ipagroup, target, config(8, "512Mi"), nil)).To(Succeed())
+	})
+
+	It("should reject more than the allowed replica increase", func() {
+		Expect(validateRecommendation(ipagroup, target, config(9, "1Gi"), nil)).To(MatchError(ContainSubstring("replicas increase")))
+	})
+
+	It("should reject more than the allowed memory cut", func() {
+		Expect(validateRecommendation(ipagroup, target, config(4, "256Mi"), nil)).To(MatchError(ContainSubstring("memoryLimit decrease")))
+	})
+
+	It("should not apply step limits to clamped fields", func() {
+		clamps := []ipav1alpha1.Clamp{{Field: "replicas"}}
+		Expect(validateRecommendation(ipagroup, target, config(20, "1Gi"), clamps)).To(Succeed())
+	})
+
+	It("should check each container against its own recommendation", func() {
+		recommendation := config(4, "1Gi")
+		recommendation.Containers = map[string]agentv1.ContainerConfig{
+			"app": {CPURequest: "100m", CPULimit: "200m", MemoryRequest: "128Mi", MemoryLimit: "128Mi"},
+		}
+		Expect(validateRecommendation(ipagroup, target, recommendation, nil)).To(MatchError(ContainSubstring("container app: memoryLimit decrease")))
+		clamps := []ipav1alpha1.Clamp{{Field: "memoryLimit", Container: "app"}}
+		Expect(validateRecommendation(ipagroup, target, recommendation, clamps)).To(Succeed())
+	})
+
+	It("should skip excluded containers", func() {
+		excluded := ipagroup
+		excluded.ExcludeContainers = []string{"app"}
+		Expect(validateRecommendation(excluded, target, config(4, "256Mi"), nil)).To(Succeed())
+	})
+})
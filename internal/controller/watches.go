@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+// ipaTargetIndex indexes IPAs by the workloads they manage, as returned by targetKey.
+const ipaTargetIndex = ".spec.targets"
+
+// minEvaluationGap is the shortest time between two evaluations of an IPA
+// triggered by watched workloads, pods or events.
+const minEvaluationGap = 10 * time.Second
+
+// significantEventReasons are the event reasons that trigger a re-evaluation.
+var significantEventReasons = map[string]bool{
+	"FailedScheduling": true,
+	"BackOff":          true,
+	"Evicted":          true,
+}
+
+// targetKey identifies a workload in ipaTargetIndex, e.g. "Deployment/default/app".
+func targetKey(kind string, namespace string, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+// ipaTargets returns the index keys of every workload the IPA names in its
+// spec or has discovered through a target selector.
+func ipaTargets(obj client.Object) []string {
+	ipa := obj.(*ipav1alpha1.IPA)
+	var keys []string
+	for _, ipagroup := range ipa.Spec.Metadata.IPAGroup {
+		if ipagroup.TargetSelector == nil {
+			keys = append(keys, targetKey(scaleTargetRef(ipagroup).Kind, ipagroup.Namespace, scaleTargetRef(ipagroup).Name))
+		}
+	}
+	for _, groupStatus := range ipa.Status.Groups {
+		keys = append(keys, targetKey(groupStatus.ScaleTargetRef.Kind, groupStatus.Namespace, groupStatus.ScaleTargetRef.Name))
+	}
+	return keys
+}
+
+// ipasTargeting returns a request for every IPA that manages one of the given workloads.
+func (r *IPAReconciler) ipasTargeting(ctx context.Context, keys ...string) []reconcile.Request {
+	seen := map[types.NamespacedName]bool{}
+	var requests []reconcile.Request
+	for _, key := range keys {
+		ipaList := &ipav1alpha1.IPAList{}
+		if err := r.List(ctx, ipaList, client.MatchingFields{ipaTargetIndex: key}); err != nil {
+			continue
+		}
+		for _, ipa := range ipaList.Items {
+			name := types.NamespacedName{Name: ipa.Name, Namespace: ipa.Namespace}
+			if !seen[name] {
+				seen[name] = true
+				requests = append(requests, reconcile.Request{NamespacedName: name})
+			}
+		}
+	}
+	return requests
+}
+
+// ipasForWorkload maps a workload to the IPAs that manage it or select it.
+func (r *IPAReconciler) ipasForWorkload(ctx context.Context, obj client.Object) []reconcile.Request {
+	gvk, err := r.GroupVersionKindFor(obj)
+	if err != nil {
+		return nil
+	}
+	requests := r.ipasTargeting(ctx, targetKey(gvk.Kind, obj.GetNamespace(), obj.GetName()))
+	for _, request := range r.ipasSelecting(ctx, obj) {
+		if !containsRequest(requests, request) {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// ipasForPod maps a pod to the IPAs that manage the workload owning it.
+func (r *IPAReconciler) ipasForPod(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.ipasTargeting(ctx, podOwnerKeys(obj.(*corev1.Pod))...)
+}
+
+// ipasForEvent maps an event to the IPAs that manage the object it is about,
+// or the workload owning it when the object is a pod.
+func (r *IPAReconciler) ipasForEvent(ctx context.Context, obj client.Object) []reconcile.Request {
+	involved := obj.(*corev1.Event).InvolvedObject
+	if involved.Kind != "Pod" {
+		return r.ipasTargeting(ctx, targetKey(involved.Kind, involved.Namespace, involved.Name))
+	}
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: involved.Name, Namespace: involved.Namespace}, pod); err != nil {
+		return nil
+	}
+	return r.ipasTargeting(ctx, podOwnerKeys(pod)...)
+}
+
+// podOwnerKeys returns the index keys of the workloads that may own the pod.
+// Pods of a Deployment are owned by a ReplicaSet named after the Deployment
+// and the pod-template-hash label.
+func podOwnerKeys(pod *corev1.Pod) []string {
+	var keys []string
+	for _, owner := range pod.OwnerReferences {
+		if owner.Controller == nil || !*owner.Controller {
+			continue
+		}
+		keys = append(keys, targetKey(owner.Kind, pod.Namespace, owner.Name))
+		hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		if owner.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+			keys = append(keys, targetKey("Deployment", pod.Namespace, strings.TrimSuffix(owner.Name, "-"+hash)))
+		}
+	}
+	return keys
+}
+
+func containsRequest(requests []reconcile.Request, request reconcile.Request) bool {
+	for _, existing := range requests {
+		if existing == request {
+			return true
+		}
+	}
+	return false
+}
+
+// podSignal passes pod updates that show a container was OOM killed, a
+// container entered CrashLoopBackOff or the pod could not be scheduled.
+var podSignal = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldPod, ok := e.ObjectOld.(*corev1.Pod)
+		if !ok {
+			return false
+		}
+		newPod, ok := e.ObjectNew.(*corev1.Pod)
+		if !ok {
+			return false
+		}
+		return podSignals(newPod) > podSignals(oldPod) || (isUnschedulable(newPod) && !isUnschedulable(oldPod))
+	},
+}
+
+// podSignals counts the OOM kills and crash loops currently visible in the
+// pod's container statuses.
+func podSignals(pod *corev1.Pod) int {
+	signals := 0
+	for _, status := range pod.Status.ContainerStatuses {
+		if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.Reason == "OOMKilled" {
+			signals += int(status.RestartCount)
+		}
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason == "CrashLoopBackOff" {
+			signals++
+		}
+	}
+	return signals
+}
+
+func isUnschedulable(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse && condition.Reason == corev1.PodReasonUnschedulable {
+			return true
+		}
+	}
+	return false
+}
+
+// eventSignal passes new events, or repeats of existing ones, with a significant reason.
+var eventSignal = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		coreEvent, ok := e.Object.(*corev1.Event)
+		return ok && significantEventReasons[coreEvent.Reason]
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldEvent, ok := e.ObjectOld.(*corev1.Event)
+		if !ok {
+			return false
+		}
+		newEvent, ok := e.ObjectNew.(*corev1.Event)
+		return ok && significantEventReasons[newEvent.Reason] && newEvent.Count > oldEvent.Count
+	},
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+}
+
+// rolloutStalled passes Deployment updates where the rollout has just
+// exceeded its progress deadline.
+var rolloutStalled = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldDeployment, ok := e.ObjectOld.(*appsv1.Deployment)
+		if !ok {
+			return false
+		}
+		newDeployment, ok := e.ObjectNew.(*appsv1.Deployment)
+		return ok && isStalled(newDeployment) && !isStalled(oldDeployment)
+	},
+}
+
+func isStalled(deployment *appsv1.Deployment) bool {
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded" {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluationLimiter spaces out evaluations of each IPA by minEvaluationGap.
+// The zero value is ready to use.
+type evaluationLimiter struct {
+	mu   sync.Mutex
+	last map[types.NamespacedName]time.Time
+}
+
+// wait returns how long the IPA must wait before it can be evaluated again.
+// When it returns zero the evaluation is recorded as happening now.
+func (l *evaluationLimiter) wait(name types.NamespacedName, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if last, ok := l.last[name]; ok && now.Sub(last) < minEvaluationGap {
+		return minEvaluationGap - now.Sub(last)
+	}
+	if l.last == nil {
+		l.last = map[types.NamespacedName]time.Time{}
+	}
+	l.last[name] = now
+	return 0
+}
+
+// forget drops the IPA, e.g. once it was deleted.
+func (l *evaluationLimiter) forget(name types.NamespacedName) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.last, name)
+}
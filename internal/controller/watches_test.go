@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+var _ = Describe("Watches", func() {
+	ctx := context.Background()
+	scheme := newScheme()
+
+	controllerRef := true
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "app-7d9f8b6c5-x2x4q",
+		Namespace: "default",
+		Labels:    map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "7d9f8b6c5"},
+		OwnerReferences: []metav1.OwnerReference{
+			{Kind: "ReplicaSet", Name: "app-7d9f8b6c5", Controller: &controllerRef},
+		},
+	}}
+
+	It("should map a pod to the IPA managing its Deployment", func() {
+		ipa := &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+		ipa.Spec.Metadata.IPAGroup = []ipav1alpha1.IPAGroup{{Deployment: "app", Namespace: "default"}}
+		other := &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{Name: "batch", Namespace: "default"}}
+		other.Spec.Metadata.IPAGroup = []ipav1alpha1.IPAGroup{{Deployment: "worker", Namespace: "default"}}
+		reconciler := &IPAReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithIndex(&ipav1alpha1.IPA{}, ipaTargetIndex, ipaTargets).
+			WithObjects(ipa, other, pod).Build()}
+
+		Expect(podOwnerKeys(pod)).To(ConsistOf("ReplicaSet/default/app-7d9f8b6c5", "Deployment/default/app"))
+		requests := reconciler.ipasForPod(ctx, pod)
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Name).To(Equal("web"))
+
+		backOff := &corev1.Event{Reason: "BackOff", InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: pod.Name, Namespace: pod.Namespace}}
+		Expect(reconciler.ipasForEvent(ctx, backOff)).To(Equal(requests))
+	})
+
+	It("should only pass significant pod changes", func() {
+		oomKilled := pod.DeepCopy()
+		oomKilled.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:                 "app",
+			RestartCount:         1,
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled"}},
+		}}
+		Expect(podSignal.Update(event.UpdateEvent{ObjectOld: pod, ObjectNew: oomKilled})).To(BeTrue())
+		Expect(podSignal.Update(event.UpdateEvent{ObjectOld: oomKilled, ObjectNew: oomKilled.DeepCopy()})).To(BeFalse())
+
+		unschedulable := pod.DeepCopy()
+		unschedulable.Status.Conditions = []corev1.PodCondition{{
+			Type:   corev1.PodScheduled,
+			Status: corev1.ConditionFalse,
+			Reason: corev1.PodReasonUnschedulable,
+		}}
+		Expect(podSignal.Update(event.UpdateEvent{ObjectOld: pod, ObjectNew: unschedulable})).To(BeTrue())
+		Expect(podSignal.Create(event.CreateEvent{Object: pod})).To(BeFalse())
+	})
+
+	It("should only pass events with a significant reason", func() {
+		Expect(eventSignal.Create(event.CreateEvent{Object: &corev1.Event{Reason: "FailedScheduling"}})).To(BeTrue())
+		Expect(eventSignal.Create(event.CreateEvent{Object: &corev1.Event{Reason: "Pulled"}})).To(BeFalse())
+		Expect(eventSignal.Update(event.UpdateEvent{
+			ObjectOld: &corev1.Event{Reason: "BackOff", Count: 3},
+			ObjectNew: &corev1.Event{Reason: "BackOff", Count: 4},
+		})).To(BeTrue())
+	})
+
+	It("should space out evaluations of the same IPA", func() {
+		limiter := &evaluationLimiter{}
+		name := types.NamespacedName{Name: "web", Namespace: "default"}
+		now := time.Now()
+		Expect(limiter.wait(name, now)).To(BeZero())
+		Expect(limiter.wait(name, now.Add(4*time.Second))).To(Equal(6 * time.Second))
+		Expect(limiter.wait(types.NamespacedName{Name: "batch", Namespace: "default"}, now)).To(BeZero())
+		Expect(limiter.wait(name, now.Add(minEvaluationGap))).To(BeZero())
+		limiter.forget(name)
+		Expect(limiter.wait(name, now.Add(minEvaluationGap+time.Second))).To(BeZero())
+	})
+})
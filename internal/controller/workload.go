@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+// fieldManager is the field manager IPA applies workload changes as. GitOps
+// tools see it as the owner of spec.replicas and the managed container resources.
+const fieldManager = "ipa-controller"
+
+// workload is the scale target of an IPA group as read through its /scale
+// subresource and, when the kind has one, its pod template.
+type workload struct {
+	object        *unstructured.Unstructured
+	replicas      int32
+	readyReplicas int32
+	selector      labels.Selector
+	// containers is nil when the kind has no pod template, in which case only
+	// the replica count is managed.
+	containers []corev1.Container
+}
+
+// scaleTargetRef returns the workload the group scales, falling back to the
+// deprecated deployment field. An empty apiVersion defaults to apps/v1.
+func scaleTargetRef(ipagroup ipav1alpha1.IPAGroup) autoscalingv2.CrossVersionObjectReference {
+	if ipagroup.ScaleTargetRef != nil {
+		ref := *ipagroup.ScaleTargetRef
+		if ref.APIVersion == "" {
+			ref.APIVersion = "apps/v1"
+		}
+		return ref
+	}
+	return autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: ipagroup.Deployment}
+}
+
+// describeTarget names a workload in messages, e.g. "StatefulSet default/db".
+func describeTarget(namespace string, ref autoscalingv2.CrossVersionObjectReference) string {
+	return fmt.Sprintf("%s %s/%s", ref.Kind, namespace, ref.Name)
+}
+
+// getWorkload reads the scale target of the group.
+func (r *IPAReconciler) getWorkload(ctx context.Context, namespace string, ref autoscalingv2.CrossVersionObjectReference) (*workload, error) {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing apiVersion %q: %v", ref.APIVersion, err)
+	}
+	object := &unstructured.Unstructured{}
+	object.SetGroupVersionKind(gv.WithKind(ref.Kind))
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, object); err != nil {
+		return nil, fmt.Errorf("error getting %s: %w", ref.Kind, err)
+	}
+	scale := &unstructured.Unstructured{}
+	scale.SetGroupVersionKind(autoscalingv1.SchemeGroupVersion.WithKind("Scale"))
+	if err := r.SubResource("scale").Get(ctx, object, scale); err != nil {
+		return nil, fmt.Errorf("error getting scale subresource: %v", err)
+	}
+	replicas, _, _ := unstructured.NestedInt64(scale.Object, "spec", "replicas")
+	selectorString, _, _ := unstructured.NestedString(scale.Object, "status", "selector")
+	if selectorString == "" {
+		return nil, fmt.Errorf("scale subresource of %s reports no pod selector", ref.Kind)
+	}
+	selector, err := labels.Parse(selectorString)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing pod selector %q: %v", selectorString, err)
+	}
+	readyReplicas, _, _ := unstructured.NestedInt64(object.Object, "status", "readyReplicas")
+	w := &workload{
+		object:        object,
+		replicas:      int32(replicas),
+		readyReplicas: int32(readyReplicas),
+		selector:      selector,
+	}
+	rawContainers, found, err := unstructured.NestedSlice(object.Object, "spec", "template", "spec", "containers")
+	if err != nil {
+		return nil, fmt.Errorf("error reading pod template: %v", err)
+	}
+	if !found {
+		return w, nil
+	}
+	w.containers = []corev1.Container{}
+	for _, rawContainer := range rawContainers {
+		fields, ok := rawContainer.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unexpected container in pod template: %v", rawContainer)
+		}
+		var container corev1.Container
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(fields, &container); err != nil {
+			return nil, fmt.Errorf("error reading pod template: %v", err)
+		}
+		w.containers = append(w.containers, container)
+	}
+	return w, nil
+}
+
+// applyWorkload server-side applies the replica count and container
+// resources as fieldManager in a single request, taking ownership of exactly
+// those fields even when another manager set them. Kinds whose replica count
+// is not known to live at spec.replicas are scaled through the /scale
+// subresource instead, retrying conflicts with backoff. A non-nil original
+// is stored in the originalAnnotation in the same request, so the snapshot is
+// saved before IPA first changes the workload; a nil original removes the
+// annotation.
+func (r *IPAReconciler) applyWorkload(ctx context.Context, w *workload, replicas int32, resources map[string]corev1.ResourceRequirements,
+	original *ipav1alpha1.WorkloadSnapshot) error {
+	apply, err := applyConfiguration(w, replicas, resources, original)
+	if err != nil {
+		return err
+	}
+	if apply != nil {
+		// Forcing ownership never conflicts, so the apply is not retried.
+		if err := r.Patch(ctx, apply, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+			return fmt.Errorf("error applying %s: %v", w.object.GetKind(), err)
+		}
+	}
+	if replicasInSpec(w.object.GetKind()) || replicas == w.replicas {
+		return nil
+	}
+	patch := []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas))
+	err = retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		scale := &unstructured.Unstructured{}
+		scale.SetGroupVersionKind(autoscalingv1.SchemeGroupVersion.WithKind("Scale"))
+		return r.SubResource("scale").Patch(ctx, w.object, client.RawPatch(types.MergePatchType, patch),
+			&client.SubResourcePatchOptions{SubResourceBody: scale, PatchOptions: client.PatchOptions{FieldManager: fieldManager}})
+	})
+	if err != nil {
+		return fmt.Errorf("error scaling %s: %v", w.object.GetKind(), err)
+	}
+	return nil
+}
+
+// applyConfiguration builds the server-side apply object for the workload,
+// holding only the fields IPA owns. It returns nil if there is nothing to apply.
+func applyConfiguration(w *workload, replicas int32, resources map[string]corev1.ResourceRequirements,
+	original *ipav1alpha1.WorkloadSnapshot) (*unstructured.Unstructured, error) {
+	apply := &unstructured.Unstructured{}
+	apply.SetGroupVersionKind(w.object.GroupVersionKind())
+	apply.SetName(w.object.GetName())
+	apply.SetNamespace(w.object.GetNamespace())
+	// Leaving the annotation out of the apply removes it, so an apply is
+	// needed as long as the workload still carries it.
+	_, annotated := w.object.GetAnnotations()[originalAnnotation]
+	empty := !annotated
+	if original != nil {
+		data, err := json.Marshal(original)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling original workload: %v", err)
+		}
+		apply.SetAnnotations(map[string]string{originalAnnotation: string(data)})
+		empty = false
+	}
+	if replicasInSpec(w.object.GetKind()) {
+		if err := unstructured.SetNestedField(apply.Object, int64(replicas), "spec", "replicas"); err != nil {
+			return nil, err
+		}
+		empty = false
+	}
+	var containers []any
+	for _, container := range w.containers {
+		requirements, ok := resources[container.Name]
+		if !ok {
+			continue
+		}
+		rawResources, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&requirements)
+		if err != nil {
+			return nil, fmt.Errorf("error converting resources of container %s: %v", container.Name, err)
+		}
+		containers = append(containers, map[string]any{"name": container.Name, "resources": rawResources})
+	}
+	if len(containers) > 0 {
+		if err := unstructured.SetNestedSlice(apply.Object, containers, "spec", "template", "spec", "containers"); err != nil {
+			return nil, err
+		}
+		empty = false
+	}
+	if empty {
+		return nil, nil
+	}
+	return apply, nil
+}
+
+// appliedResources returns, by container name, the resource requests and
+// limits fieldManager owns on the workload from earlier applies. Server-side
+// apply deletes an owned field that a later apply leaves out.
+func appliedResources(object *unstructured.Unstructured) (map[string]map[string][]corev1.ResourceName, error) {
+	applied := map[string]map[string][]corev1.ResourceName{}
+	for _, entry := range object.GetManagedFields() {
+		if entry.Manager != fieldManager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+		fields := map[string]any{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			return nil, fmt.Errorf("error reading managed fields: %v", err)
+		}
+		containers, _, _ := unstructured.NestedMap(fields, "f:spec", "f:template", "f:spec", "f:containers")
+		for key, containerFields := range containers {
+			var container struct {
+				Name string `json:"name"`
+			}
+			if !strings.HasPrefix(key, "k:") || json.Unmarshal([]byte(strings.TrimPrefix(key, "k:")), &container) != nil {
+				continue
+			}
+			resourceFields, _, _ := unstructured.NestedMap(containerFields.(map[string]any), "f:resources")
+			for _, kind := range []string{"requests", "limits"} {
+				names, _, _ := unstructured.NestedMap(resourceFields, "f:"+kind)
+				for name := range names {
+					if !strings.HasPrefix(name, "f:") {
+						continue
+					}
+					if applied[container.Name] == nil {
+						applied[container.Name] = map[string][]corev1.ResourceName{}
+					}
+					applied[container.Name][kind] = append(applied[container.Name][kind], corev1.ResourceName(strings.TrimPrefix(name, "f:")))
+				}
+			}
+		}
+	}
+	return applied, nil
+}
+
+// replicasInSpec reports whether the kind keeps its replica count at
+// spec.replicas, so it can be applied together with the pod template.
+func replicasInSpec(kind string) bool {
+	switch kind {
+	case "Deployment", "StatefulSet", "ReplicaSet", "Rollout":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	agentv1 "github.com/shafinhasnat/ipa/api/agent/v1"
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	controller "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+var _ = Describe("Workload", func() {
+	target := func(kind string) *workload {
+		object := &unstructured.Unstructured{}
+		object.SetGroupVersionKind(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: kind})
+		object.SetName("app")
+		object.SetNamespace("default")
+		object.SetLabels(map[string]string{"owner": "gitops"})
+		return &workload{
+			object:     object,
+			replicas:   2,
+			containers: []corev1.Container{{Name: "app"}, {Name: "sidecar"}},
+		}
+	}
+	resources := map[string]corev1.ResourceRequirements{
+		"app": {Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")}},
+	}
+
+	It("should apply only the replicas and the owned container resources", func() {
+		apply, err := applyConfiguration(target("Deployment"), 3, resources, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apply.GetLabels()).To(BeEmpty())
+		Expect(apply.Object["spec"]).To(Equal(map[string]any{
+			"replicas": int64(3),
+			"template": map[string]any{"spec": map[string]any{"containers": []any{
+				map[string]any{"name": "app", "resources": map[string]any{"requests": map[string]any{"cpu": "250m"}}},
+			}}},
+		}))
+	})
+
+	It("should leave replicas to the scale subresource for other kinds", func() {
+		apply, err := applyConfiguration(target("CronTab"), 3, resources, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apply.Object["spec"]).NotTo(HaveKey("replicas"))
+
+		apply, err = applyConfiguration(target("CronTab"), 3, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apply).To(BeNil())
+	})
+
+	It("should store the original snapshot with the change and drop it on release", func() {
+		original := &ipav1alpha1.WorkloadSnapshot{Replicas: 2}
+		w := target("CronTab")
+		apply, err := applyConfiguration(w, 3, nil, original)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apply.GetAnnotations()).To(HaveKey(originalAnnotation))
+
+		w.object.SetAnnotations(apply.GetAnnotations())
+		stored, err := originalSnapshot(w)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.Replicas).To(Equal(int32(2)))
+		apply, err = applyConfiguration(w, 3, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apply.GetAnnotations()).To(BeEmpty())
+	})
+
+	It("should keep applying the fields of earlier applies when a later one narrows", func() {
+		w := target("Deployment")
+		ipagroup := ipav1alpha1.IPAGroup{Deployment: "app"}
+		config := controller.Config{Replicas: 2, CPURequest: "100m", CPULimit: "200m", MemoryRequest: "64Mi", MemoryLimit: "128Mi"}
+		first, err := desiredResources(ipagroup, w, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first).To(HaveLen(2))
+
+		// The API server now holds the first apply, owned by fieldManager.
+		for i := range w.containers {
+			w.containers[i].Resources = first[w.containers[i].Name]
+		}
+		owned := `{"f:cpu":{},"f:memory":{}}`
+		container := `{"f:resources":{"f:requests":` + owned + `,"f:limits":` + owned + `}}`
+		w.object.SetManagedFields([]metav1.ManagedFieldsEntry{{
+			Manager:   fieldManager,
+			Operation: metav1.ManagedFieldsOperationApply,
+			FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{},"f:template":{"f:spec":{"f:containers":{` +
+				`"k:{\"name\":\"app\"}":` + container + `,"k:{\"name\":\"sidecar\"}":` + container + `}}}}}`)},
+		}})
+
+		// Limits are no longer managed, the sidecar is excluded and the agent
+		// only answers for the app container.
+		ipagroup.ControlledValues = ipav1alpha1.ControlledRequestsOnly
+		ipagroup.ExcludeContainers = []string{"sidecar"}
+		config = controller.Config{Replicas: 2, Containers: map[string]agentv1.ContainerConfig{
+			"app": {CPURequest: "150m", CPULimit: "300m", MemoryRequest: "96Mi", MemoryLimit: "128Mi"},
+		}}
+		second, err := desiredResources(ipagroup, w, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second["app"].Requests).To(Equal(corev1.ResourceList{
+			corev1.ResourceCPU: resource.MustParse("150m"), corev1.ResourceMemory: resource.MustParse("96Mi"),
+		}))
+		Expect(second["app"].Limits).To(Equal(first["app"].Limits))
+		Expect(second["sidecar"]).To(Equal(first["sidecar"]))
+
+		apply, err := applyConfiguration(w, 2, second, nil)
+		Expect(err).NotTo(HaveOccurred())
+		containers, _, _ := unstructured.NestedSlice(apply.Object, "spec", "template", "spec", "containers")
+		Expect(containers).To(HaveLen(2))
+		Expect(containers[1]).To(HaveKeyWithValue("resources", HaveKeyWithValue("limits", HaveKeyWithValue("memory", "128Mi"))))
+	})
+})
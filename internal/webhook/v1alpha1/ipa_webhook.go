@@ -0,0 +1,342 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+	agent "github.com/shafinhasnat/ipa/internal/agent"
+)
+
+var ipalog = logf.Log.WithName("ipa-resource")
+
+const (
+	// defaultInterval is the evaluation interval set on IPAs that do not set one.
+	defaultInterval = 1 * time.Minute
+	// defaultMinReplicas is the replica floor set on groups that do not set one,
+	// so a recommendation can never scale a workload to zero.
+	defaultMinReplicas = int32(1)
+)
+
+// SetupIPAWebhookWithManager registers the defaulting and validating webhooks for IPA in the manager.
+func SetupIPAWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&ipav1alpha1.IPA{}).
+		WithDefaulter(&IPACustomDefaulter{}).
+		WithValidator(&IPACustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-ipa-shafinhasnat-me-v1alpha1-ipa,mutating=true,failurePolicy=fail,sideEffects=None,groups=ipa.shafinhasnat.me,resources=ipas,verbs=create;update,versions=v1alpha1,name=mipa-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// IPACustomDefaulter fills in the interval, the group namespaces and the
+// replica floor of IPAs when they are created or updated.
+type IPACustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &IPACustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter.
+func (d *IPACustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	ipa, ok := obj.(*ipav1alpha1.IPA)
+	if !ok {
+		return fmt.Errorf("expected an IPA object but got %T", obj)
+	}
+	ipalog.Info("defaulting", "name", ipa.GetName())
+
+	namespace := ipa.Namespace
+	if namespace == "" {
+		if req, err := admission.RequestFromContext(ctx); err == nil {
+			namespace = req.Namespace
+		}
+	}
+	if ipa.Spec.Interval == nil {
+		ipa.Spec.Interval = &metav1.Duration{Duration: defaultInterval}
+	}
+	for i := range ipa.Spec.Metadata.IPAGroup {
+		ipagroup := &ipa.Spec.Metadata.IPAGroup[i]
+		selectsNamespaces := ipagroup.TargetSelector != nil && ipagroup.TargetSelector.NamespaceSelector != nil
+		if ipagroup.Namespace == "" && !selectsNamespaces {
+			ipagroup.Namespace = namespace
+		}
+		if ipagroup.MinReplicas == nil {
+			minReplicas := defaultMinReplicas
+			if ipagroup.MaxReplicas != nil && *ipagroup.MaxReplicas < minReplicas {
+				minReplicas = *ipagroup.MaxReplicas
+			}
+			ipagroup.MinReplicas = &minReplicas
+		}
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-ipa-shafinhasnat-me-v1alpha1-ipa,mutating=false,failurePolicy=fail,sideEffects=None,groups=ipa.shafinhasnat.me,resources=ipas,verbs=create;update,versions=v1alpha1,name=vipa-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// IPACustomValidator rejects IPAs with malformed endpoint URIs, no groups,
+// duplicate targets, inverted bounds or groups in namespaces that do not exist.
+type IPACustomValidator struct {
+	Client client.Client
+}
+
+var _ webhook.CustomValidator = &IPACustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator.
+func (v *IPACustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	ipa, ok := obj.(*ipav1alpha1.IPA)
+	if !ok {
+		return nil, fmt.Errorf("expected an IPA object but got %T", obj)
+	}
+	ipalog.Info("validation for IPA upon creation", "name", ipa.GetName())
+	return nil, v.validateIPA(ctx, ipa, nil)
+}
+
+// ValidateUpdate implements webhook.CustomValidator. IPAs being deleted and
+// updates that leave the spec alone, such as the controller adding or
+// removing its finalizer, are always allowed.
+func (v *IPACustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	ipa, ok := newObj.(*ipav1alpha1.IPA)
+	if !ok {
+		return nil, fmt.Errorf("expected an IPA object for the newObj but got %T", newObj)
+	}
+	old, ok := oldObj.(*ipav1alpha1.IPA)
+	if !ok {
+		return nil, fmt.Errorf("expected an IPA object for the oldObj but got %T", oldObj)
+	}
+	ipalog.Info("validation for IPA upon update", "name", ipa.GetName())
+	if !ipa.DeletionTimestamp.IsZero() || equality.Semantic.DeepEqual(old.Spec, ipa.Spec) {
+		return nil, nil
+	}
+	return nil, v.validateIPA(ctx, ipa, old)
+}
+
+// ValidateDelete implements webhook.CustomValidator. Deleting an IPA is always allowed.
+func (v *IPACustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateIPA validates ipa. On update old is the previous version, and only
+// namespaces it did not already use are checked for existence, so a group
+// whose namespace was deleted does not block unrelated changes.
+func (v *IPACustomValidator) validateIPA(ctx context.Context, ipa *ipav1alpha1.IPA, old *ipav1alpha1.IPA) error {
+	metadataPath := field.NewPath("spec", "metadata")
+	var allErrs field.ErrorList
+	usesPrometheus := ipa.Spec.Metadata.MetricsSource == "" || ipa.Spec.Metadata.MetricsSource == ipav1alpha1.MetricsSourcePrometheus
+	if usesPrometheus || ipa.Spec.Metadata.PrometheusUri != "" {
+		if err := validateURI(metadataPath.Child("prometheusUri"), ipa.Spec.Metadata.PrometheusUri); err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+	if err := validateURI(metadataPath.Child("llmAgent"), ipa.Spec.Metadata.LLMAgent); err != nil {
+		allErrs = append(allErrs, err)
+	}
+
+	groupsPath := metadataPath.Child("ipaGroup")
+	if len(ipa.Spec.Metadata.IPAGroup) == 0 {
+		allErrs = append(allErrs, field.Required(groupsPath, "at least one group is required"))
+	}
+	targets := map[string]int{}
+	checkedNamespaces := map[string]bool{}
+	if old != nil {
+		for _, ipagroup := range old.Spec.Metadata.IPAGroup {
+			checkedNamespaces[ipagroup.Namespace] = true
+		}
+	}
+	for i, ipagroup := range ipa.Spec.Metadata.IPAGroup {
+		groupPath := groupsPath.Index(i)
+		if key := targetKey(ipagroup); key != "" {
+			if first, ok := targets[key]; ok {
+				allErrs = append(allErrs, field.Duplicate(groupPath, fmt.Sprintf("%s, also targeted by %s", key, groupsPath.Index(first))))
+			} else {
+				targets[key] = i
+			}
+		}
+		allErrs = append(allErrs, validateBounds(groupPath, ipagroup)...)
+		allErrs = append(allErrs, validateQueries(groupPath.Child("queries"), ipagroup.Queries)...)
+		allErrs = append(allErrs, validateWindow(groupPath.Child("window"), ipagroup.Window)...)
+		if len(ipagroup.Queries) > 0 && !usesPrometheus {
+			allErrs = append(allErrs, field.Forbidden(groupPath.Child("queries"), "custom queries need the Prometheus metrics source"))
+		}
+		if ipagroup.Namespace != "" && !checkedNamespaces[ipagroup.Namespace] {
+			checkedNamespaces[ipagroup.Namespace] = true
+			err := v.Client.Get(ctx, client.ObjectKey{Name: ipagroup.Namespace}, &corev1.Namespace{})
+			if apierrors.IsNotFound(err) {
+				allErrs = append(allErrs, field.NotFound(groupPath.Child("namespace"), ipagroup.Namespace))
+			} else if err != nil {
+				allErrs = append(allErrs, field.InternalError(groupPath.Child("namespace"), fmt.Errorf("error getting namespace: %v", err)))
+			}
+		}
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(ipav1alpha1.GroupVersion.WithKind("IPA").GroupKind(), ipa.Name, allErrs)
+}
+
+// validateURI requires an absolute http or https URL.
+func validateURI(path *field.Path, uri string) *field.Error {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return field.Invalid(path, uri, err.Error())
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return field.Invalid(path, uri, "must be an http or https URL")
+	}
+	if parsed.Host == "" {
+		return field.Invalid(path, uri, "must include a host")
+	}
+	return nil
+}
+
+// targetKey identifies the workload a group names, e.g. "Deployment default/app".
+// Groups with a target selector name no workload and return an empty key.
+func targetKey(ipagroup ipav1alpha1.IPAGroup) string {
+	switch {
+	case ipagroup.ScaleTargetRef != nil:
+		return fmt.Sprintf("%s %s/%s", ipagroup.ScaleTargetRef.Kind, ipagroup.Namespace, ipagroup.ScaleTargetRef.Name)
+	case ipagroup.Deployment != "":
+		return fmt.Sprintf("Deployment %s/%s", ipagroup.Namespace, ipagroup.Deployment)
+	}
+	return ""
+}
+
+// builtinMetrics are the metric names of the built-in queries, which custom
+// queries may not reuse.
+var builtinMetrics = func() map[string]bool {
+	names := map[string]bool{}
+	for _, name := range agent.BuiltinMetrics() {
+		names[name] = true
+	}
+	return names
+}()
+
+// validateQueries rejects custom queries that shadow a built-in metric or
+// whose template does not render.
+func validateQueries(path *field.Path, queries []ipav1alpha1.MetricQuery) field.ErrorList {
+	var allErrs field.ErrorList
+	sample := agent.QueryData{Namespace: "default", Deployment: "app", Kind: "Deployment", PodRegex: "app-.*", Ingress: "app", RateWindow: "2m"}
+	for i, query := range queries {
+		if builtinMetrics[query.Name] {
+			allErrs = append(allErrs, field.Invalid(path.Index(i).Child("name"), query.Name, "must not be the name of a built-in metric"))
+		}
+		if _, err := agent.RenderQuery(query.Query, sample); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Index(i).Child("query"), query.Query, err.Error()))
+		}
+	}
+	return allErrs
+}
+
+// maxWindowSamples bounds the samples per series of a group's own window,
+// keeping the request sent to the agent small.
+const maxWindowSamples = 500
+
+// validateWindow rejects windows that are not positive, have a step longer
+// than their range or more than maxWindowSamples samples per series.
+func validateWindow(path *field.Path, window *ipav1alpha1.MetricsWindow) field.ErrorList {
+	if window == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+	for _, duration := range []struct {
+		name  string
+		value *metav1.Duration
+	}{
+		{"range", window.Range},
+		{"step", window.Step},
+		{"rateWindow", window.RateWindow},
+	} {
+		if duration.value != nil && duration.value.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child(duration.name), duration.value.Duration.String(), "must be positive"))
+		}
+	}
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+	rangeDuration, step := agent.DefaultWindow.Range, agent.DefaultWindow.Step
+	if window.Range != nil {
+		rangeDuration = window.Range.Duration
+	}
+	if window.Step != nil {
+		step = window.Step.Duration
+	}
+	if step > rangeDuration {
+		allErrs = append(allErrs, field.Invalid(path.Child("step"), step.String(), fmt.Sprintf("must not be longer than the range %s", rangeDuration)))
+	} else if samples := rangeDuration / step; samples > maxWindowSamples {
+		allErrs = append(allErrs, field.Invalid(path.Child("range"), rangeDuration.String(),
+			fmt.Sprintf("gives %d samples per series at a step of %s, at most %d are allowed", samples, step, maxWindowSamples)))
+	}
+	return allErrs
+}
+
+// validateBounds rejects replica and resource bounds whose minimum is above their maximum.
+func validateBounds(path *field.Path, ipagroup ipav1alpha1.IPAGroup) field.ErrorList {
+	var allErrs field.ErrorList
+	if ipagroup.MinReplicas != nil && ipagroup.MaxReplicas != nil && *ipagroup.MinReplicas > *ipagroup.MaxReplicas {
+		allErrs = append(allErrs, field.Invalid(path.Child("minReplicas"), *ipagroup.MinReplicas,
+			fmt.Sprintf("must not be greater than maxReplicas %d", *ipagroup.MaxReplicas)))
+	}
+	if ipagroup.Resources == nil {
+		return allErrs
+	}
+	resourcesPath := path.Child("resources")
+	for _, quantity := range []struct {
+		name   string
+		bounds *ipav1alpha1.QuantityBounds
+	}{
+		{"cpuRequest", ipagroup.Resources.CPURequest},
+		{"cpuLimit", ipagroup.Resources.CPULimit},
+		{"memoryRequest", ipagroup.Resources.MemoryRequest},
+		{"memoryLimit", ipagroup.Resources.MemoryLimit},
+	} {
+		bounds := quantity.bounds
+		if bounds != nil && bounds.Min != nil && bounds.Max != nil && bounds.Min.Cmp(*bounds.Max) > 0 {
+			allErrs = append(allErrs, field.Invalid(resourcesPath.Child(quantity.name, "min"), bounds.Min.String(),
+				fmt.Sprintf("must not be greater than max %s", bounds.Max.String())))
+		}
+	}
+	// A request that must be above its limit can never be applied.
+	for _, pair := range []struct {
+		request, limit string
+		requestBounds  *ipav1alpha1.QuantityBounds
+		limitBounds    *ipav1alpha1.QuantityBounds
+	}{
+		{"cpuRequest", "cpuLimit", ipagroup.Resources.CPURequest, ipagroup.Resources.CPULimit},
+		{"memoryRequest", "memoryLimit", ipagroup.Resources.MemoryRequest, ipagroup.Resources.MemoryLimit},
+	} {
+		if pair.requestBounds == nil || pair.requestBounds.Min == nil || pair.limitBounds == nil || pair.limitBounds.Max == nil {
+			continue
+		}
+		if pair.requestBounds.Min.Cmp(*pair.limitBounds.Max) > 0 {
+			allErrs = append(allErrs, field.Invalid(resourcesPath.Child(pair.request, "min"), pair.requestBounds.Min.String(),
+				fmt.Sprintf("must not be greater than %s max %s", pair.limit, pair.limitBounds.Max.String())))
+		}
+	}
+	return allErrs
+}
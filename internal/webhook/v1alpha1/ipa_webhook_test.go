@@ -0,0 +1,208 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ipav1alpha1 "github.com/shafinhasnat/ipa/api/v1alpha1"
+)
+
+var _ = Describe("IPA Webhook", func() {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(ipav1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	var (
+		ipa       *ipav1alpha1.IPA
+		validator *IPACustomValidator
+		defaulter *IPACustomDefaulter
+	)
+
+	BeforeEach(func() {
+		ipa = &ipav1alpha1.IPA{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+		ipa.Spec.Metadata.PrometheusUri = "http://prometheus.monitoring.svc:9090"
+		ipa.Spec.Metadata.LLMAgent = "https://ipaagent.shafinhasnat.me"
+		ipa.Spec.Metadata.IPAGroup = []ipav1alpha1.IPAGroup{{Deployment: "app", Namespace: "default"}}
+		validator = &IPACustomValidator{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		).Build()}
+		defaulter = &IPACustomDefaulter{}
+	})
+
+	Context("When creating IPA under Defaulting Webhook", func() {
+		It("should fill in the namespace, interval and minimum replicas", func() {
+			maxReplicas := int32(6)
+			ipa.Spec.Metadata.IPAGroup = []ipav1alpha1.IPAGroup{
+				{Deployment: "app", MaxReplicas: &maxReplicas},
+				{TargetSelector: &ipav1alpha1.TargetSelector{NamespaceSelector: &metav1.LabelSelector{}}},
+			}
+			Expect(defaulter.Default(ctx, ipa)).To(Succeed())
+			Expect(ipa.Spec.Interval.Duration).To(Equal(time.Minute))
+			Expect(ipa.Spec.Metadata.IPAGroup[0].Namespace).To(Equal("default"))
+			Expect(*ipa.Spec.Metadata.IPAGroup[0].MinReplicas).To(Equal(int32(1)))
+			Expect(*ipa.Spec.Metadata.IPAGroup[0].MaxReplicas).To(Equal(int32(6)))
+			Expect(ipa.Spec.Metadata.IPAGroup[1].Namespace).To(BeEmpty())
+		})
+
+		It("should keep values that are already set", func() {
+			minReplicas := int32(3)
+			ipa.Spec.Interval = &metav1.Duration{Duration: 5 * time.Minute}
+			ipa.Spec.Metadata.IPAGroup[0].Namespace = "shop"
+			ipa.Spec.Metadata.IPAGroup[0].MinReplicas = &minReplicas
+			Expect(defaulter.Default(ctx, ipa)).To(Succeed())
+			Expect(ipa.Spec.Interval.Duration).To(Equal(5 * time.Minute))
+			Expect(ipa.Spec.Metadata.IPAGroup[0].Namespace).To(Equal("shop"))
+			Expect(*ipa.Spec.Metadata.IPAGroup[0].MinReplicas).To(Equal(int32(3)))
+		})
+	})
+
+	Context("When creating or updating IPA under Validating Webhook", func() {
+		It("should admit a well-formed IPA", func() {
+			Expect(validator.ValidateCreate(ctx, ipa)).To(BeEmpty())
+			Expect(validator.ValidateUpdate(ctx, ipa, ipa)).To(BeEmpty())
+		})
+
+		It("should reject malformed URIs", func() {
+			ipa.Spec.Metadata.PrometheusUri = "prometheus:9090"
+			ipa.Spec.Metadata.LLMAgent = "http://"
+			_, err := validator.ValidateCreate(ctx, ipa)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.metadata.prometheusUri"))
+			Expect(err.Error()).To(ContainSubstring("spec.metadata.llmAgent"))
+		})
+
+		It("should only require prometheusUri for the Prometheus metrics source", func() {
+			ipa.Spec.Metadata.MetricsSource = ipav1alpha1.MetricsSourceMetricsServer
+			ipa.Spec.Metadata.PrometheusUri = ""
+			Expect(validator.ValidateCreate(ctx, ipa)).To(BeEmpty())
+
+			ipa.Spec.Metadata.IPAGroup[0].Queries = []ipav1alpha1.MetricQuery{{Name: "lag", Query: "kafka_lag"}}
+			_, err := validator.ValidateCreate(ctx, ipa)
+			Expect(err).To(MatchError(ContainSubstring("custom queries need the Prometheus metrics source")))
+		})
+
+		It("should reject an IPA without groups", func() {
+			ipa.Spec.Metadata.IPAGroup = nil
+			_, err := validator.ValidateCreate(ctx, ipa)
+			Expect(err).To(MatchError(ContainSubstring("at least one group is required")))
+		})
+
+		It("should reject duplicate targets", func() {
+			previous := ipa.DeepCopy()
+			ipa.Spec.Metadata.IPAGroup = append(ipa.Spec.Metadata.IPAGroup, ipav1alpha1.IPAGroup{
+				ScaleTargetRef: &autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app"},
+				Namespace:      "default",
+			})
+			_, err := validator.ValidateUpdate(ctx, previous, ipa)
+			Expect(err).To(MatchError(ContainSubstring("spec.metadata.ipaGroup[1]: Duplicate value")))
+		})
+
+		It("should reject minimums above maximums", func() {
+			minReplicas, maxReplicas := int32(5), int32(2)
+			minMemory, maxMemory := resource.MustParse("2Gi"), resource.MustParse("1Gi")
+			ipa.Spec.Metadata.IPAGroup[0].MinReplicas = &minReplicas
+			ipa.Spec.Metadata.IPAGroup[0].MaxReplicas = &maxReplicas
+			minCPU, maxCPU := resource.MustParse("2"), resource.MustParse("1")
+			ipa.Spec.Metadata.IPAGroup[0].Resources = &ipav1alpha1.ResourceBounds{
+				MemoryLimit: &ipav1alpha1.QuantityBounds{Min: &minMemory, Max: &maxMemory},
+				CPURequest:  &ipav1alpha1.QuantityBounds{Min: &minCPU},
+				CPULimit:    &ipav1alpha1.QuantityBounds{Max: &maxCPU},
+			}
+			_, err := validator.ValidateCreate(ctx, ipa)
+			Expect(err).To(MatchError(ContainSubstring("spec.metadata.ipaGroup[0].minReplicas")))
+			Expect(err).To(MatchError(ContainSubstring("spec.metadata.ipaGroup[0].resources.memoryLimit.min")))
+			Expect(err).To(MatchError(ContainSubstring("spec.metadata.ipaGroup[0].resources.cpuRequest.min: Invalid value: \"2\": must not be greater than cpuLimit max 1")))
+		})
+
+		It("should reject custom queries that do not render or shadow a built-in metric", func() {
+			ipa.Spec.Metadata.IPAGroup[0].Queries = []ipav1alpha1.MetricQuery{
+				{Name: "queue_depth", Query: `sum(queue_depth{namespace="{{.Namespace}}"})`},
+				{Name: "cpu_usage", Query: `sum(rate(cpu{pod=~"{{.PodRegex}}"}[2m]))`},
+				{Name: "lag", Query: `kafka_lag{group="{{.Consumer}}"}`},
+			}
+			_, err := validator.ValidateCreate(ctx, ipa)
+			Expect(err).To(MatchError(ContainSubstring("spec.metadata.ipaGroup[0].queries[1].name")))
+			Expect(err).To(MatchError(ContainSubstring("spec.metadata.ipaGroup[0].queries[2].query")))
+			Expect(err).NotTo(MatchError(ContainSubstring("queries[0]")))
+		})
+
+		It("should reject windows with too many samples or a step longer than the range", func() {
+			ipa.Spec.Metadata.IPAGroup[0].Window = &ipav1alpha1.MetricsWindow{
+				Range: &metav1.Duration{Duration: 24 * time.Hour},
+				Step:  &metav1.Duration{Duration: 15 * time.Minute},
+			}
+			Expect(validator.ValidateCreate(ctx, ipa)).To(BeEmpty())
+
+			ipa.Spec.Metadata.IPAGroup[0].Window.Step = &metav1.Duration{Duration: 30 * time.Second}
+			_, err := validator.ValidateCreate(ctx, ipa)
+			Expect(err).To(MatchError(ContainSubstring("gives 2880 samples per series")))
+
+			ipa.Spec.Metadata.IPAGroup[0].Window = &ipav1alpha1.MetricsWindow{Step: &metav1.Duration{Duration: 10 * time.Minute}}
+			_, err = validator.ValidateCreate(ctx, ipa)
+			Expect(err).To(MatchError(ContainSubstring("must not be longer than the range 5m0s")))
+		})
+
+		It("should reject namespaces that do not exist", func() {
+			ipa.Spec.Metadata.IPAGroup[0].Namespace = "missing"
+			_, err := validator.ValidateCreate(ctx, ipa)
+			Expect(err).To(MatchError(ContainSubstring("spec.metadata.ipaGroup[0].namespace: Not found")))
+		})
+
+		It("should only check namespaces that an update adds", func() {
+			ipa.Spec.Metadata.IPAGroup[0].Namespace = "deleted"
+			previous := ipa.DeepCopy()
+			ipa.Spec.Interval = &metav1.Duration{Duration: 5 * time.Minute}
+			Expect(validator.ValidateUpdate(ctx, previous, ipa)).To(BeEmpty())
+
+			ipa.Spec.Metadata.IPAGroup = append(ipa.Spec.Metadata.IPAGroup, ipav1alpha1.IPAGroup{Deployment: "db", Namespace: "missing"})
+			_, err := validator.ValidateUpdate(ctx, previous, ipa)
+			Expect(err).To(MatchError(ContainSubstring("spec.metadata.ipaGroup[1].namespace: Not found")))
+			Expect(err).NotTo(MatchError(ContainSubstring("ipaGroup[0]")))
+		})
+
+		It("should allow finalizer changes and IPAs being deleted", func() {
+			ipa.Spec.Metadata.IPAGroup = nil
+			previous := ipa.DeepCopy()
+			ipa.Finalizers = []string{"ipa.shafinhasnat.me/restore"}
+			Expect(validator.ValidateUpdate(ctx, previous, ipa)).To(BeEmpty())
+
+			now := metav1.Now()
+			ipa.DeletionTimestamp = &now
+			ipa.Spec.Interval = &metav1.Duration{Duration: time.Minute}
+			Expect(validator.ValidateUpdate(ctx, previous, ipa)).To(BeEmpty())
+		})
+
+		It("should always allow deletion", func() {
+			ipa.Spec.Metadata.IPAGroup = nil
+			Expect(validator.ValidateDelete(ctx, ipa)).To(BeEmpty())
+		})
+	})
+})